@@ -0,0 +1,572 @@
+// Package authadmin exposes the AuthorizationX API over HTTP so it can be
+// mounted inside an admin service
+package authadmin
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	AuthorizationGo "github.com/SoegiDev/AuthorizationGo"
+	"github.com/SoegiDev/AuthorizationGo/authchi"
+	"github.com/go-chi/chi/v5"
+)
+
+// DefaultPermission is the permission required to use the API when Options
+// does not set one
+const DefaultPermission = "authorization.admin"
+
+var errBadRequest = errors.New("bad request")
+
+type Options struct {
+	// Permission is required from the caller on every endpoint, defaults to
+	// DefaultPermission
+	Permission string
+	// Subject returns the id of the caller, by default it reads the value
+	// stored by authchi.WithUserID
+	Subject func(r *http.Request) (uint, error)
+	// OnError receives the errors not mapped to a status code, the caller
+	// only gets a generic internal error so the cause is not leaked. By
+	// default they are written to the standard logger.
+	OnError func(r *http.Request, err error)
+}
+
+// NameRequest creates or renames a role or permission
+type NameRequest struct {
+	Name string `json:"name"`
+}
+
+// PermissionsRequest grants permissions to a role
+type PermissionsRequest struct {
+	Permissions []string `json:"permissions"`
+}
+
+// RoleRequest assigns a role to a user
+type RoleRequest struct {
+	Role string `json:"role"`
+}
+
+type RolesResponse struct {
+	Roles []string `json:"roles"`
+}
+
+type PermissionsResponse struct {
+	Permissions []string `json:"permissions"`
+}
+
+type UsersResponse struct {
+	Users []uint `json:"users"`
+}
+
+type CheckResponse struct {
+	Allowed bool `json:"allowed"`
+}
+
+type DeleteResponse struct {
+	Affected int64 `json:"affected"`
+}
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+type handler struct {
+	auth    *AuthorizationGo.AuthorizationX
+	onError func(r *http.Request, err error)
+}
+
+// NewHandler returns the admin API, every endpoint requires the caller to
+// have opts.Permission
+func NewHandler(auth *AuthorizationGo.AuthorizationX, opts Options) http.Handler {
+	if opts.Permission == "" {
+		opts.Permission = DefaultPermission
+	}
+	if opts.OnError == nil {
+		opts.OnError = logError
+	}
+	guard := authchi.New(auth, authchi.Options{Subject: opts.Subject})
+	h := &handler{auth: auth, onError: opts.OnError}
+
+	r := chi.NewRouter()
+	r.Use(guard.RequirePermission(opts.Permission))
+
+	r.Get("/roles", h.listRoles)
+	r.Post("/roles", h.createRole)
+	r.Put("/roles/{role}", h.renameRole)
+	r.Delete("/roles/{role}", h.deleteRole)
+	r.Post("/roles/{role}/restore", h.restoreRole)
+	r.Get("/roles/{role}/users", h.listUsersWithRole)
+	r.Post("/roles/{role}/permissions", h.assignPermissions)
+	r.Get("/roles/{role}/permissions/{permission}", h.checkRolePermission)
+	r.Delete("/roles/{role}/permissions/{permission}", h.revokeRolePermission)
+
+	r.Get("/permissions", h.listPermissions)
+	r.Post("/permissions", h.createPermission)
+	r.Put("/permissions/{permission}", h.renamePermission)
+	r.Delete("/permissions/{permission}", h.deletePermission)
+	r.Post("/permissions/{permission}/restore", h.restorePermission)
+	r.Get("/permissions/{permission}/roles", h.listRolesWithPermission)
+	r.Get("/permissions/{permission}/users", h.listUsersWithPermission)
+
+	r.Get("/users/{user}/roles", h.listUserRoles)
+	r.Post("/users/{user}/roles", h.assignRole)
+	r.Get("/users/{user}/roles/{role}", h.checkRole)
+	r.Delete("/users/{user}/roles/{role}", h.revokeRole)
+	r.Get("/users/{user}/permissions/{permission}", h.checkPermission)
+	r.Delete("/users/{user}/permissions/{permission}", h.revokePermission)
+
+	return r
+}
+
+func (h *handler) listRoles(w http.ResponseWriter, r *http.Request) {
+	opts, err := listOptions(r)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	roles, err := h.authz(r).ListRoles(opts)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, RolesResponse{Roles: nonNil(roles)})
+}
+
+func (h *handler) createRole(w http.ResponseWriter, r *http.Request) {
+	var req NameRequest
+	if err := readJSON(r, &req); err != nil || req.Name == "" {
+		h.writeError(w, r, errBadRequest)
+		return
+	}
+
+	if err := h.authz(r).CreateRole(req.Name); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (h *handler) renameRole(w http.ResponseWriter, r *http.Request) {
+	var req NameRequest
+	if err := readJSON(r, &req); err != nil || req.Name == "" {
+		h.writeError(w, r, errBadRequest)
+		return
+	}
+
+	if err := h.authz(r).RenameRole(chi.URLParam(r, "role"), req.Name); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) deleteRole(w http.ResponseWriter, r *http.Request) {
+	affected, err := h.authz(r).DeleteRoleCount(chi.URLParam(r, "role"), deleteOptions(r)...)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, DeleteResponse{Affected: affected})
+}
+
+func (h *handler) restoreRole(w http.ResponseWriter, r *http.Request) {
+	if err := h.authz(r).RestoreRole(chi.URLParam(r, "role")); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) listUsersWithRole(w http.ResponseWriter, r *http.Request) {
+	opts, err := listOptions(r)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	users, err := h.authz(r).ListUsersWithRole(chi.URLParam(r, "role"), opts)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, UsersResponse{Users: nonNil(users)})
+}
+
+func (h *handler) assignPermissions(w http.ResponseWriter, r *http.Request) {
+	var req PermissionsRequest
+	if err := readJSON(r, &req); err != nil || len(req.Permissions) == 0 {
+		h.writeError(w, r, errBadRequest)
+		return
+	}
+
+	if err := h.authz(r).AssignPermissions(chi.URLParam(r, "role"), req.Permissions); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) checkRolePermission(w http.ResponseWriter, r *http.Request) {
+	ok, err := h.authz(r).CheckRolePermission(chi.URLParam(r, "role"), chi.URLParam(r, "permission"))
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, CheckResponse{Allowed: ok})
+}
+
+func (h *handler) revokeRolePermission(w http.ResponseWriter, r *http.Request) {
+	if err := h.authz(r).RevokeRolePermission(chi.URLParam(r, "role"), chi.URLParam(r, "permission")); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) listPermissions(w http.ResponseWriter, r *http.Request) {
+	opts, err := listOptions(r)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	perms, err := h.authz(r).ListPermissions(opts)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, PermissionsResponse{Permissions: nonNil(perms)})
+}
+
+func (h *handler) createPermission(w http.ResponseWriter, r *http.Request) {
+	var req NameRequest
+	if err := readJSON(r, &req); err != nil || req.Name == "" {
+		h.writeError(w, r, errBadRequest)
+		return
+	}
+
+	if err := h.authz(r).CreatePermission(req.Name); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (h *handler) renamePermission(w http.ResponseWriter, r *http.Request) {
+	var req NameRequest
+	if err := readJSON(r, &req); err != nil || req.Name == "" {
+		h.writeError(w, r, errBadRequest)
+		return
+	}
+
+	if err := h.authz(r).RenamePermission(chi.URLParam(r, "permission"), req.Name); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) deletePermission(w http.ResponseWriter, r *http.Request) {
+	affected, err := h.authz(r).DeletePermissionCount(chi.URLParam(r, "permission"), deleteOptions(r)...)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, DeleteResponse{Affected: affected})
+}
+
+func (h *handler) restorePermission(w http.ResponseWriter, r *http.Request) {
+	if err := h.authz(r).RestorePermission(chi.URLParam(r, "permission")); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) listRolesWithPermission(w http.ResponseWriter, r *http.Request) {
+	opts, err := listOptions(r)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	roles, err := h.authz(r).ListRolesWithPermission(chi.URLParam(r, "permission"), opts)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, RolesResponse{Roles: nonNil(roles)})
+}
+
+func (h *handler) listUsersWithPermission(w http.ResponseWriter, r *http.Request) {
+	opts, err := listOptions(r)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	users, err := h.authz(r).GetUsersWithPermission(chi.URLParam(r, "permission"), opts)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, UsersResponse{Users: nonNil(users)})
+}
+
+func (h *handler) listUserRoles(w http.ResponseWriter, r *http.Request) {
+	userID, err := userParam(r)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	opts, err := listOptions(r)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	roles, err := h.authz(r).ListUserRoles(userID, opts)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, RolesResponse{Roles: nonNil(roles)})
+}
+
+func (h *handler) assignRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := userParam(r)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	var req RoleRequest
+	if err := readJSON(r, &req); err != nil || req.Role == "" {
+		h.writeError(w, r, errBadRequest)
+		return
+	}
+
+	if err := h.authz(r).AssignRole(userID, req.Role); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) checkRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := userParam(r)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	ok, err := h.authz(r).CheckRole(userID, chi.URLParam(r, "role"))
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, CheckResponse{Allowed: ok})
+}
+
+func (h *handler) revokeRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := userParam(r)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	var opts []AuthorizationGo.RevokeOption
+	if r.URL.Query().Get("dependents") == "true" {
+		opts = append(opts, AuthorizationGo.WithDependentRoles())
+	}
+
+	if err := h.authz(r).RevokeRole(userID, chi.URLParam(r, "role"), opts...); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) checkPermission(w http.ResponseWriter, r *http.Request) {
+	userID, err := userParam(r)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	ok, err := h.authz(r).CheckPermission(userID, chi.URLParam(r, "permission"))
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, CheckResponse{Allowed: ok})
+}
+
+func (h *handler) revokePermission(w http.ResponseWriter, r *http.Request) {
+	userID, err := userParam(r)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	if err := h.authz(r).RevokePermission(userID, chi.URLParam(r, "permission")); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authz returns the AuthorizationX running with the request context, so the
+// spans are children of the request span and the queries stop with the request
+func (h *handler) authz(r *http.Request) *AuthorizationGo.AuthorizationX {
+	return h.auth.WithContext(r.Context())
+}
+
+func userParam(r *http.Request) (uint, error) {
+	userID, err := strconv.ParseUint(chi.URLParam(r, "user"), 10, 0)
+	if err != nil {
+		return 0, errBadRequest
+	}
+
+	return uint(userID), nil
+}
+
+// listOptions reads the limit, offset, prefix, contains and sort query
+// parameters
+func listOptions(r *http.Request) (AuthorizationGo.ListOptions, error) {
+	q := r.URL.Query()
+	opts := AuthorizationGo.ListOptions{
+		Prefix:   q.Get("prefix"),
+		Contains: q.Get("contains"),
+	}
+
+	var err error
+	if v := q.Get("limit"); v != "" {
+		if opts.Limit, err = strconv.Atoi(v); err != nil || opts.Limit < 0 {
+			return opts, errBadRequest
+		}
+	}
+	if v := q.Get("offset"); v != "" {
+		if opts.Offset, err = strconv.Atoi(v); err != nil || opts.Offset < 0 {
+			return opts, errBadRequest
+		}
+	}
+
+	switch q.Get("sort") {
+	case "", "name":
+		opts.Sort = AuthorizationGo.SortByNameAsc
+	case "-name":
+		opts.Sort = AuthorizationGo.SortByNameDesc
+	case "id":
+		opts.Sort = AuthorizationGo.SortByIDAsc
+	case "-id":
+		opts.Sort = AuthorizationGo.SortByIDDesc
+	default:
+		return opts, errBadRequest
+	}
+
+	return opts, nil
+}
+
+// deleteOptions reads the cascade, force, purge and reassign_to query
+// parameters
+func deleteOptions(r *http.Request) []AuthorizationGo.DeleteOption {
+	q := r.URL.Query()
+
+	var opts []AuthorizationGo.DeleteOption
+	if q.Get("cascade") == "true" {
+		opts = append(opts, AuthorizationGo.WithCascade())
+	}
+	if q.Get("force") == "true" {
+		opts = append(opts, AuthorizationGo.WithForce())
+	}
+	if q.Get("purge") == "true" {
+		opts = append(opts, AuthorizationGo.WithPurge())
+	}
+	if v := q.Get("reassign_to"); v != "" {
+		opts = append(opts, AuthorizationGo.WithReassignTo(v))
+	}
+
+	return opts
+}
+
+func readJSON(r *http.Request, v any) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError maps the AuthorizationGo errors to status codes, the other errors
+// are reported to onError and answered with a generic internal error
+func (h *handler) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var status int
+	switch {
+	case errors.Is(err, errBadRequest):
+		status = http.StatusBadRequest
+	case errors.Is(err, AuthorizationGo.ErrRoleNotFound),
+		errors.Is(err, AuthorizationGo.ErrPermissionNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, AuthorizationGo.ErrRoleInUse),
+		errors.Is(err, AuthorizationGo.ErrPermissionInUse),
+		errors.Is(err, AuthorizationGo.ErrRoleAlreadyExists),
+		errors.Is(err, AuthorizationGo.ErrPermissionAlreadyExists),
+		errors.Is(err, AuthorizationGo.ErrRoleAlreadyAssigned),
+		errors.Is(err, AuthorizationGo.ErrReassignToSelf),
+		errors.Is(err, AuthorizationGo.ErrRoleConflict),
+		errors.Is(err, AuthorizationGo.ErrRoleNotAssigned),
+		errors.Is(err, AuthorizationGo.ErrAssignmentLimit),
+		errors.Is(err, AuthorizationGo.ErrMissingPrerequisite),
+		errors.Is(err, AuthorizationGo.ErrRoleRequired):
+		status = http.StatusConflict
+	case errors.Is(err, AuthorizationGo.ErrRoleConflictWithSelf),
+		errors.Is(err, AuthorizationGo.ErrPrerequisiteCycle):
+		status = http.StatusUnprocessableEntity
+	default:
+		h.onError(r, err)
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "internal error"})
+		return
+	}
+
+	writeJSON(w, status, ErrorResponse{Error: err.Error()})
+}
+
+func logError(r *http.Request, err error) {
+	log.Printf("authadmin: %s %s: %v", r.Method, r.URL.Path, err)
+}
+
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
@@ -0,0 +1,274 @@
+package authadmin_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	AuthorizationGo "github.com/SoegiDev/AuthorizationGo"
+	"github.com/SoegiDev/AuthorizationGo/authadmin"
+	"github.com/SoegiDev/AuthorizationGo/authchi"
+	"github.com/SoegiDev/AuthorizationGo/internal/testdb"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gorm.io/gorm"
+)
+
+var db *gorm.DB
+
+var prefix_test string = "authGo_admin_"
+
+func TestMain(m *testing.M) {
+	var err error
+	db, err = testdb.Open("authadmin")
+	if err != nil {
+		log.Fatal("Error opening the test database: ", err)
+	}
+
+	os.Exit(m.Run())
+}
+
+const adminID = 99
+
+func setup(t *testing.T) (*AuthorizationGo.AuthorizationX, http.Handler) {
+	auth := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: prefix_test,
+		DB:           db,
+	})
+
+	auth.CreateRole("admin")
+	auth.CreatePermission(authadmin.DefaultPermission)
+	auth.AssignPermissions("admin", []string{authadmin.DefaultPermission})
+	auth.AssignRole(adminID, "admin")
+
+	t.Cleanup(func() {
+		db.Where("1 = 1").Delete(AuthorizationGo.UserRole{})
+		db.Where("1 = 1").Delete(AuthorizationGo.RolePermission{})
+		db.Where("1 = 1").Delete(AuthorizationGo.RoleConflict{})
+		db.Where("1 = 1").Delete(AuthorizationGo.RoleLimit{})
+		db.Where("1 = 1").Delete(AuthorizationGo.UserLimit{})
+		db.Where("1 = 1").Delete(AuthorizationGo.RolePrerequisite{})
+		db.Unscoped().Where("1 = 1").Delete(&AuthorizationGo.Role{})
+		db.Unscoped().Where("1 = 1").Delete(&AuthorizationGo.Permission{})
+	})
+
+	return auth, authadmin.NewHandler(auth, authadmin.Options{})
+}
+
+func do(h http.Handler, userID uint, method string, path string, body any) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	if userID != 0 {
+		req = req.WithContext(authchi.WithUserID(req.Context(), userID))
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestHandler(t *testing.T) {
+	auth, h := setup(t)
+
+	tests := []struct {
+		method string
+		path   string
+		body   any
+		status int
+	}{
+		{http.MethodPost, "/roles", authadmin.NameRequest{Name: "role-a"}, http.StatusCreated},
+		{http.MethodPost, "/roles", authadmin.NameRequest{}, http.StatusBadRequest},
+		{http.MethodPost, "/permissions", authadmin.NameRequest{Name: "permission-a"}, http.StatusCreated},
+		{http.MethodPost, "/roles/role-a/permissions", authadmin.PermissionsRequest{Permissions: []string{"permission-a"}}, http.StatusNoContent},
+		{http.MethodPost, "/roles/role-aa/permissions", authadmin.PermissionsRequest{Permissions: []string{"permission-a"}}, http.StatusNotFound},
+		{http.MethodPost, "/users/1/roles", authadmin.RoleRequest{Role: "role-a"}, http.StatusNoContent},
+		{http.MethodPost, "/users/1/roles", authadmin.RoleRequest{Role: "role-a"}, http.StatusConflict},
+		{http.MethodPost, "/users/x/roles", authadmin.RoleRequest{Role: "role-a"}, http.StatusBadRequest},
+		{http.MethodGet, "/users/1/permissions/permission-a", nil, http.StatusOK},
+		{http.MethodGet, "/users/1/permissions/permission-aa", nil, http.StatusNotFound},
+		{http.MethodPut, "/roles/role-a", authadmin.NameRequest{Name: "admin"}, http.StatusConflict},
+		{http.MethodDelete, "/roles/role-a", nil, http.StatusConflict},
+		{http.MethodGet, "/roles?sort=bad", nil, http.StatusBadRequest},
+		{http.MethodDelete, "/roles/role-a?cascade=true", nil, http.StatusOK},
+		{http.MethodPost, "/roles/role-a/restore", nil, http.StatusNoContent},
+		{http.MethodDelete, "/permissions/permission-a", nil, http.StatusConflict},
+		{http.MethodDelete, "/roles/role-a/permissions/permission-a", nil, http.StatusNoContent},
+		{http.MethodDelete, "/permissions/permission-a", nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := do(h, adminID, tt.method, tt.path, tt.body)
+		if w.Code != tt.status {
+			t.Errorf("%s %s: expecting status %d, got %d %s", tt.method, tt.path, tt.status, w.Code, w.Body)
+		}
+	}
+
+	ok, _ := auth.CheckRole(1, "role-a")
+	if ok {
+		t.Error("expecting the cascade delete to revoke the role")
+	}
+}
+
+func TestHandlerConstraints(t *testing.T) {
+	auth, h := setup(t)
+
+	auth.CreateRole("initiator")
+	auth.CreateRole("approver")
+	auth.CreateRole("auditor")
+	auth.AddRoleConflict(AuthorizationGo.StaticConflict, "initiator", "approver")
+	auth.AssignRoles(1, []string{"initiator", "auditor"})
+	auth.SetRoleMaxHolders("initiator", 1)
+	auth.CreateRole("employee")
+	auth.CreateRole("engineer")
+	auth.AddRolePrerequisite("engineer", "employee")
+	auth.AssignRoles(3, []string{"employee", "engineer"})
+
+	tests := []struct {
+		method string
+		path   string
+		body   any
+		status int
+	}{
+		{http.MethodPost, "/users/1/roles", authadmin.RoleRequest{Role: "approver"}, http.StatusConflict},
+		{http.MethodDelete, "/roles/auditor?reassign_to=approver", nil, http.StatusConflict},
+		{http.MethodPost, "/users/2/roles", authadmin.RoleRequest{Role: "initiator"}, http.StatusConflict},
+		{http.MethodPost, "/users/2/roles", authadmin.RoleRequest{Role: "engineer"}, http.StatusConflict},
+		{http.MethodDelete, "/users/3/roles/employee", nil, http.StatusConflict},
+		{http.MethodDelete, "/users/3/roles/employee?dependents=true", nil, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		w := do(h, adminID, tt.method, tt.path, tt.body)
+		if w.Code != tt.status {
+			t.Errorf("%s %s: expecting status %d, got %d %s", tt.method, tt.path, tt.status, w.Code, w.Body)
+		}
+	}
+
+	roles, _ := auth.GetUserRoles(3)
+	if len(roles) != 0 {
+		t.Error("expecting the dependent roles to be revoked", roles)
+	}
+}
+
+func TestHandlerResponses(t *testing.T) {
+	auth, h := setup(t)
+
+	auth.CreateRole("role-a")
+	auth.CreatePermission("permission-a")
+	auth.AssignPermissions("role-a", []string{"permission-a"})
+	auth.AssignRole(1, "role-a")
+
+	var roles authadmin.RolesResponse
+	w := do(h, adminID, http.MethodGet, "/roles?limit=1&sort=-name", nil)
+	json.NewDecoder(w.Body).Decode(&roles)
+	if len(roles.Roles) != 1 || roles.Roles[0] != "role-a" {
+		t.Error("failed assert listing roles", roles.Roles)
+	}
+
+	var users authadmin.UsersResponse
+	w = do(h, adminID, http.MethodGet, "/permissions/permission-a/users", nil)
+	json.NewDecoder(w.Body).Decode(&users)
+	if len(users.Users) != 1 || users.Users[0] != 1 {
+		t.Error("failed assert listing users with permission", users.Users)
+	}
+
+	var check authadmin.CheckResponse
+	w = do(h, adminID, http.MethodGet, "/users/1/roles/role-a", nil)
+	json.NewDecoder(w.Body).Decode(&check)
+	if !check.Allowed {
+		t.Error("expecting the role check to be allowed")
+	}
+
+	var deleted authadmin.DeleteResponse
+	w = do(h, adminID, http.MethodDelete, "/roles/role-a?force=true&purge=true", nil)
+	json.NewDecoder(w.Body).Decode(&deleted)
+	if deleted.Affected != 1 {
+		t.Error("expecting 1 affected assignment, got", deleted.Affected)
+	}
+}
+
+func TestHandlerGuard(t *testing.T) {
+	_, h := setup(t)
+
+	w := do(h, 0, http.MethodGet, "/roles", nil)
+	if w.Code != http.StatusUnauthorized {
+		t.Error("expecting 401 without a subject, got", w.Code)
+	}
+
+	w = do(h, 1, http.MethodGet, "/roles", nil)
+	if w.Code != http.StatusForbidden {
+		t.Error("expecting 403 without the admin permission, got", w.Code)
+	}
+}
+
+func TestHandlerContext(t *testing.T) {
+	setup(t)
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	auth := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix:   prefix_test,
+		DB:             db,
+		TracerProvider: provider,
+	})
+	h := authadmin.NewHandler(auth, authadmin.Options{})
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "request")
+	req := httptest.NewRequest(http.MethodGet, "/roles", nil)
+	req = req.WithContext(authchi.WithUserID(ctx, adminID))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	parent.End()
+
+	if w.Code != http.StatusOK {
+		t.Fatal("unexpected status", w.Code)
+	}
+	found := false
+	for _, span := range recorder.Ended() {
+		if span.Name() == "AuthorizationX.ListRoles" {
+			found = true
+			if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+				t.Error("expecting ListRoles to be a child of the request span")
+			}
+		}
+	}
+	if !found {
+		t.Error("expecting a ListRoles span")
+	}
+}
+
+func TestHandlerInternalError(t *testing.T) {
+	auth, _ := setup(t)
+
+	var reported error
+	h := authadmin.NewHandler(auth, authadmin.Options{
+		OnError: func(r *http.Request, err error) { reported = err },
+	})
+
+	// the roles query fails with a database error
+	db.Callback().Query().Before("gorm:query").Register("test:fail", func(tx *gorm.DB) {
+		if tx.Statement.Schema != nil && tx.Statement.Schema.Name == "Role" {
+			tx.AddError(errors.New("dial tcp 10.0.0.1:5432: connection refused"))
+		}
+	})
+	w := do(h, adminID, http.MethodGet, "/roles", nil)
+	db.Callback().Query().Remove("test:fail")
+
+	if w.Code != http.StatusInternalServerError {
+		t.Error("expecting 500, got", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "10.0.0.1") {
+		t.Error("expecting the cause to be hidden from the caller", w.Body.String())
+	}
+	if reported == nil || !strings.Contains(reported.Error(), "10.0.0.1") {
+		t.Error("expecting the cause to be reported", reported)
+	}
+}
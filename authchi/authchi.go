@@ -0,0 +1,102 @@
+// Package authchi guards chi routes, or any net/http handler, with
+// AuthorizationGo permission and role checks
+package authchi
+
+import (
+	"context"
+	"net/http"
+
+	AuthorizationGo "github.com/SoegiDev/AuthorizationGo"
+	"github.com/SoegiDev/AuthorizationGo/internal/subject"
+)
+
+var ErrMissingSubject = subject.ErrMissing
+
+type contextKey struct{}
+
+// WithUserID returns a copy of ctx carrying the user id read by the default
+// subject extractor
+func WithUserID(ctx context.Context, userID uint) context.Context {
+	return context.WithValue(ctx, contextKey{}, userID)
+}
+
+// UserID returns the user id stored by WithUserID
+func UserID(ctx context.Context) (uint, bool) {
+	userID, ok := ctx.Value(contextKey{}).(uint)
+	return userID, ok
+}
+
+type Options struct {
+	// Subject returns the id of the user making the request, by default it
+	// reads the value stored by WithUserID
+	Subject func(r *http.Request) (uint, error)
+	// Abort ends a request which is not allowed, err is nil when the user
+	// lacks the permission or role. By default it replies with 401 for
+	// ErrMissingSubject, 403 when denied and 500 for any other error.
+	Abort func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// Guard builds chi middleware checking the user of the request
+type Guard struct {
+	auth AuthorizationGo.Checker
+	opts Options
+}
+
+func New(auth AuthorizationGo.Checker, opts Options) *Guard {
+	if opts.Subject == nil {
+		opts.Subject = defaultSubject
+	}
+	if opts.Abort == nil {
+		opts.Abort = defaultAbort
+	}
+
+	return &Guard{auth: auth, opts: opts}
+}
+
+// RequirePermission allows the request when the user has the permission
+func (g *Guard) RequirePermission(permName string) func(http.Handler) http.Handler {
+	return g.require(func(auth AuthorizationGo.Checker, userID uint) (bool, error) {
+		return auth.CheckPermission(userID, permName)
+	})
+}
+
+// RequireRole allows the request when the user has the role
+func (g *Guard) RequireRole(roleName string) func(http.Handler) http.Handler {
+	return g.require(func(auth AuthorizationGo.Checker, userID uint) (bool, error) {
+		return auth.CheckRole(userID, roleName)
+	})
+}
+
+func (g *Guard) require(check func(auth AuthorizationGo.Checker, userID uint) (bool, error)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, err := g.opts.Subject(r)
+			if err != nil {
+				g.opts.Abort(w, r, err)
+				return
+			}
+
+			ok, err := check(AuthorizationGo.CheckerWithContext(r.Context(), g.auth), userID)
+			if err != nil || !ok {
+				g.opts.Abort(w, r, err)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func defaultSubject(r *http.Request) (uint, error) {
+	userID, ok := UserID(r.Context())
+	if !ok {
+		return 0, ErrMissingSubject
+	}
+
+	return userID, nil
+}
+
+func defaultAbort(w http.ResponseWriter, r *http.Request, err error) {
+	status := subject.Status(err)
+	http.Error(w, http.StatusText(status), status)
+}
@@ -0,0 +1,80 @@
+package authchi_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/SoegiDev/AuthorizationGo/authchi"
+	"github.com/SoegiDev/AuthorizationGo/internal/guardtest"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestGuard(t *testing.T) {
+	guard := authchi.New(guardtest.Checker{}, authchi.Options{})
+
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if id, err := strconv.ParseUint(r.Header.Get(guardtest.UserHeader), 10, 0); err == nil {
+				r = r.WithContext(authchi.WithUserID(r.Context(), uint(id)))
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	r.With(guard.RequirePermission("permission-a")).Get("/permission", ok)
+	r.With(guard.RequireRole("role-a")).Get("/role", ok)
+	r.With(guard.RequirePermission("broken")).Get("/broken", ok)
+
+	guardtest.Run(t, func(req *http.Request) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	})
+}
+
+func TestGuardOptions(t *testing.T) {
+	guard := authchi.New(guardtest.Checker{}, authchi.Options{
+		Subject: func(r *http.Request) (uint, error) {
+			return 2, nil
+		},
+		Abort: func(w http.ResponseWriter, r *http.Request, err error) {
+			w.WriteHeader(http.StatusNotFound)
+		},
+	})
+
+	r := chi.NewRouter()
+	r.With(guard.RequirePermission("permission-a")).Get("/permission", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/permission", nil))
+	if w.Code != http.StatusNotFound {
+		t.Error("expecting the custom abort handler to be used, got", w.Code)
+	}
+}
+
+func TestGuardContext(t *testing.T) {
+	guard := authchi.New(guardtest.ContextChecker{}, authchi.Options{
+		Subject: func(r *http.Request) (uint, error) {
+			return 2, nil
+		},
+	})
+
+	r := chi.NewRouter()
+	r.With(guard.RequirePermission("permission-a")).Get("/permission", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/permission", nil)
+	req = req.WithContext(context.WithValue(req.Context(), guardtest.RequestKey{}, true))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Error("expecting the check to run with the context of the request, got", w.Code)
+	}
+}
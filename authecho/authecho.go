@@ -0,0 +1,87 @@
+// Package authecho guards echo routes with AuthorizationGo permission and role
+// checks
+package authecho
+
+import (
+	AuthorizationGo "github.com/SoegiDev/AuthorizationGo"
+	"github.com/SoegiDev/AuthorizationGo/internal/subject"
+	"github.com/labstack/echo/v4"
+)
+
+// SubjectKey is the context key read by the default subject extractor
+const SubjectKey = "userID"
+
+var ErrMissingSubject = subject.ErrMissing
+
+type Options struct {
+	// Subject returns the id of the user making the request, by default it
+	// reads the value stored under SubjectKey
+	Subject func(c echo.Context) (uint, error)
+	// Abort ends a request which is not allowed, err is nil when the user
+	// lacks the permission or role. By default it returns an echo.HTTPError
+	// with 401 for ErrMissingSubject, 403 when denied and 500 for any other
+	// error.
+	Abort func(c echo.Context, err error) error
+}
+
+// Guard builds echo middleware checking the user of the request
+type Guard struct {
+	auth AuthorizationGo.Checker
+	opts Options
+}
+
+func New(auth AuthorizationGo.Checker, opts Options) *Guard {
+	if opts.Subject == nil {
+		opts.Subject = defaultSubject
+	}
+	if opts.Abort == nil {
+		opts.Abort = defaultAbort
+	}
+
+	return &Guard{auth: auth, opts: opts}
+}
+
+// RequirePermission allows the request when the user has the permission
+func (g *Guard) RequirePermission(permName string) echo.MiddlewareFunc {
+	return g.require(func(auth AuthorizationGo.Checker, userID uint) (bool, error) {
+		return auth.CheckPermission(userID, permName)
+	})
+}
+
+// RequireRole allows the request when the user has the role
+func (g *Guard) RequireRole(roleName string) echo.MiddlewareFunc {
+	return g.require(func(auth AuthorizationGo.Checker, userID uint) (bool, error) {
+		return auth.CheckRole(userID, roleName)
+	})
+}
+
+func (g *Guard) require(check func(auth AuthorizationGo.Checker, userID uint) (bool, error)) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			userID, err := g.opts.Subject(c)
+			if err != nil {
+				return g.opts.Abort(c, err)
+			}
+
+			ok, err := check(AuthorizationGo.CheckerWithContext(c.Request().Context(), g.auth), userID)
+			if err != nil || !ok {
+				return g.opts.Abort(c, err)
+			}
+
+			return next(c)
+		}
+	}
+}
+
+func defaultSubject(c echo.Context) (uint, error) {
+	userID, ok := subject.UserID(c.Get(SubjectKey))
+	if !ok {
+		return 0, ErrMissingSubject
+	}
+
+	return userID, nil
+}
+
+func defaultAbort(c echo.Context, err error) error {
+	return echo.NewHTTPError(subject.Status(err)).SetInternal(err)
+}
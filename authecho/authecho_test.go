@@ -0,0 +1,79 @@
+package authecho_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SoegiDev/AuthorizationGo/authecho"
+	"github.com/SoegiDev/AuthorizationGo/internal/guardtest"
+	"github.com/labstack/echo/v4"
+)
+
+func TestGuard(t *testing.T) {
+	guard := authecho.New(guardtest.Checker{}, authecho.Options{})
+
+	e := echo.New()
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if id := c.Request().Header.Get(guardtest.UserHeader); id != "" {
+				c.Set(authecho.SubjectKey, id)
+			}
+			return next(c)
+		}
+	})
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	e.GET("/permission", ok, guard.RequirePermission("permission-a"))
+	e.GET("/role", ok, guard.RequireRole("role-a"))
+	e.GET("/broken", ok, guard.RequirePermission("broken"))
+
+	guardtest.Run(t, func(req *http.Request) int {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	})
+}
+
+func TestGuardOptions(t *testing.T) {
+	guard := authecho.New(guardtest.Checker{}, authecho.Options{
+		Subject: func(c echo.Context) (uint, error) {
+			return 2, nil
+		},
+		Abort: func(c echo.Context, err error) error {
+			return c.NoContent(http.StatusNotFound)
+		},
+	})
+
+	e := echo.New()
+	e.GET("/permission", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, guard.RequirePermission("permission-a"))
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/permission", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Error("expecting the custom abort handler to be used, got", rec.Code)
+	}
+}
+
+func TestGuardContext(t *testing.T) {
+	guard := authecho.New(guardtest.ContextChecker{}, authecho.Options{
+		Subject: func(c echo.Context) (uint, error) {
+			return 2, nil
+		},
+	})
+
+	e := echo.New()
+	e.GET("/permission", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, guard.RequirePermission("permission-a"))
+
+	req := httptest.NewRequest(http.MethodGet, "/permission", nil)
+	req = req.WithContext(context.WithValue(req.Context(), guardtest.RequestKey{}, true))
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Error("expecting the check to run with the context of the request, got", rec.Code)
+	}
+}
@@ -0,0 +1,84 @@
+// Package authfiber guards fiber routes with AuthorizationGo permission and
+// role checks
+package authfiber
+
+import (
+	AuthorizationGo "github.com/SoegiDev/AuthorizationGo"
+	"github.com/SoegiDev/AuthorizationGo/internal/subject"
+	"github.com/gofiber/fiber/v2"
+)
+
+// SubjectKey is the locals key read by the default subject extractor
+const SubjectKey = "userID"
+
+var ErrMissingSubject = subject.ErrMissing
+
+type Options struct {
+	// Subject returns the id of the user making the request, by default it
+	// reads the local stored under SubjectKey
+	Subject func(c *fiber.Ctx) (uint, error)
+	// Abort ends a request which is not allowed, err is nil when the user
+	// lacks the permission or role. By default it returns a fiber.Error with
+	// 401 for ErrMissingSubject, 403 when denied and 500 for any other error.
+	Abort func(c *fiber.Ctx, err error) error
+}
+
+// Guard builds fiber handlers checking the user of the request
+type Guard struct {
+	auth AuthorizationGo.Checker
+	opts Options
+}
+
+func New(auth AuthorizationGo.Checker, opts Options) *Guard {
+	if opts.Subject == nil {
+		opts.Subject = defaultSubject
+	}
+	if opts.Abort == nil {
+		opts.Abort = defaultAbort
+	}
+
+	return &Guard{auth: auth, opts: opts}
+}
+
+// RequirePermission allows the request when the user has the permission
+func (g *Guard) RequirePermission(permName string) fiber.Handler {
+	return g.require(func(auth AuthorizationGo.Checker, userID uint) (bool, error) {
+		return auth.CheckPermission(userID, permName)
+	})
+}
+
+// RequireRole allows the request when the user has the role
+func (g *Guard) RequireRole(roleName string) fiber.Handler {
+	return g.require(func(auth AuthorizationGo.Checker, userID uint) (bool, error) {
+		return auth.CheckRole(userID, roleName)
+	})
+}
+
+func (g *Guard) require(check func(auth AuthorizationGo.Checker, userID uint) (bool, error)) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, err := g.opts.Subject(c)
+		if err != nil {
+			return g.opts.Abort(c, err)
+		}
+
+		ok, err := check(AuthorizationGo.CheckerWithContext(c.UserContext(), g.auth), userID)
+		if err != nil || !ok {
+			return g.opts.Abort(c, err)
+		}
+
+		return c.Next()
+	}
+}
+
+func defaultSubject(c *fiber.Ctx) (uint, error) {
+	userID, ok := subject.UserID(c.Locals(SubjectKey))
+	if !ok {
+		return 0, ErrMissingSubject
+	}
+
+	return userID, nil
+}
+
+func defaultAbort(c *fiber.Ctx, err error) error {
+	return fiber.NewError(subject.Status(err))
+}
@@ -0,0 +1,85 @@
+package authfiber_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SoegiDev/AuthorizationGo/authfiber"
+	"github.com/SoegiDev/AuthorizationGo/internal/guardtest"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestGuard(t *testing.T) {
+	guard := authfiber.New(guardtest.Checker{}, authfiber.Options{})
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if id := c.Get(guardtest.UserHeader); id != "" {
+			c.Locals(authfiber.SubjectKey, id)
+		}
+		return c.Next()
+	})
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(http.StatusOK) }
+	app.Get("/permission", guard.RequirePermission("permission-a"), ok)
+	app.Get("/role", guard.RequireRole("role-a"), ok)
+	app.Get("/broken", guard.RequirePermission("broken"), ok)
+
+	guardtest.Run(t, func(req *http.Request) int {
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal("unexpected error while sending request.", err)
+		}
+		return resp.StatusCode
+	})
+}
+
+func TestGuardOptions(t *testing.T) {
+	guard := authfiber.New(guardtest.Checker{}, authfiber.Options{
+		Subject: func(c *fiber.Ctx) (uint, error) {
+			return 2, nil
+		},
+		Abort: func(c *fiber.Ctx, err error) error {
+			return c.SendStatus(http.StatusNotFound)
+		},
+	})
+
+	app := fiber.New()
+	app.Get("/permission", guard.RequirePermission("permission-a"), func(c *fiber.Ctx) error {
+		return c.SendStatus(http.StatusOK)
+	})
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/permission", nil))
+	if err != nil {
+		t.Fatal("unexpected error while sending request.", err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Error("expecting the custom abort handler to be used, got", resp.StatusCode)
+	}
+}
+
+func TestGuardContext(t *testing.T) {
+	guard := authfiber.New(guardtest.ContextChecker{}, authfiber.Options{
+		Subject: func(c *fiber.Ctx) (uint, error) {
+			return 2, nil
+		},
+	})
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.SetUserContext(context.WithValue(c.UserContext(), guardtest.RequestKey{}, true))
+		return c.Next()
+	})
+	app.Get("/permission", guard.RequirePermission("permission-a"), func(c *fiber.Ctx) error {
+		return c.SendStatus(http.StatusOK)
+	})
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/permission", nil))
+	if err != nil {
+		t.Fatal("unexpected error while sending request.", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Error("expecting the check to run with the user context of the request, got", resp.StatusCode)
+	}
+}
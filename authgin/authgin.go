@@ -0,0 +1,87 @@
+// Package authgin guards gin routes with AuthorizationGo permission and role
+// checks
+package authgin
+
+import (
+	AuthorizationGo "github.com/SoegiDev/AuthorizationGo"
+	"github.com/SoegiDev/AuthorizationGo/internal/subject"
+	"github.com/gin-gonic/gin"
+)
+
+// SubjectKey is the context key read by the default subject extractor
+const SubjectKey = "userID"
+
+var ErrMissingSubject = subject.ErrMissing
+
+type Options struct {
+	// Subject returns the id of the user making the request, by default it
+	// reads the value stored under SubjectKey
+	Subject func(c *gin.Context) (uint, error)
+	// Abort ends a request which is not allowed, err is nil when the user
+	// lacks the permission or role. By default it aborts with 401 for
+	// ErrMissingSubject, 403 when denied and 500 for any other error.
+	Abort func(c *gin.Context, err error)
+}
+
+// Guard builds gin middleware checking the user of the request
+type Guard struct {
+	auth AuthorizationGo.Checker
+	opts Options
+}
+
+func New(auth AuthorizationGo.Checker, opts Options) *Guard {
+	if opts.Subject == nil {
+		opts.Subject = defaultSubject
+	}
+	if opts.Abort == nil {
+		opts.Abort = defaultAbort
+	}
+
+	return &Guard{auth: auth, opts: opts}
+}
+
+// RequirePermission allows the request when the user has the permission
+func (g *Guard) RequirePermission(permName string) gin.HandlerFunc {
+	return g.require(func(auth AuthorizationGo.Checker, userID uint) (bool, error) {
+		return auth.CheckPermission(userID, permName)
+	})
+}
+
+// RequireRole allows the request when the user has the role
+func (g *Guard) RequireRole(roleName string) gin.HandlerFunc {
+	return g.require(func(auth AuthorizationGo.Checker, userID uint) (bool, error) {
+		return auth.CheckRole(userID, roleName)
+	})
+}
+
+func (g *Guard) require(check func(auth AuthorizationGo.Checker, userID uint) (bool, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := g.opts.Subject(c)
+		if err != nil {
+			g.opts.Abort(c, err)
+			return
+		}
+
+		ok, err := check(AuthorizationGo.CheckerWithContext(c.Request.Context(), g.auth), userID)
+		if err != nil || !ok {
+			g.opts.Abort(c, err)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func defaultSubject(c *gin.Context) (uint, error) {
+	v, _ := c.Get(SubjectKey)
+	userID, ok := subject.UserID(v)
+	if !ok {
+		return 0, ErrMissingSubject
+	}
+
+	return userID, nil
+}
+
+func defaultAbort(c *gin.Context, err error) {
+	c.AbortWithStatus(subject.Status(err))
+}
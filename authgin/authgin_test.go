@@ -0,0 +1,79 @@
+package authgin_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SoegiDev/AuthorizationGo/authgin"
+	"github.com/SoegiDev/AuthorizationGo/internal/guardtest"
+	"github.com/gin-gonic/gin"
+)
+
+func TestGuard(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	guard := authgin.New(guardtest.Checker{}, authgin.Options{})
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if id := c.GetHeader(guardtest.UserHeader); id != "" {
+			c.Set(authgin.SubjectKey, id)
+		}
+	})
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/permission", guard.RequirePermission("permission-a"), ok)
+	r.GET("/role", guard.RequireRole("role-a"), ok)
+	r.GET("/broken", guard.RequirePermission("broken"), ok)
+
+	guardtest.Run(t, func(req *http.Request) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	})
+}
+
+func TestGuardOptions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	guard := authgin.New(guardtest.Checker{}, authgin.Options{
+		Subject: func(c *gin.Context) (uint, error) {
+			return 2, nil
+		},
+		Abort: func(c *gin.Context, err error) {
+			c.AbortWithStatus(http.StatusNotFound)
+		},
+	})
+
+	r := gin.New()
+	r.GET("/permission", guard.RequirePermission("permission-a"), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/permission", nil))
+	if w.Code != http.StatusNotFound {
+		t.Error("expecting the custom abort handler to be used, got", w.Code)
+	}
+}
+
+func TestGuardContext(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	guard := authgin.New(guardtest.ContextChecker{}, authgin.Options{
+		Subject: func(c *gin.Context) (uint, error) {
+			return 2, nil
+		},
+	})
+
+	r := gin.New()
+	r.GET("/permission", guard.RequirePermission("permission-a"), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/permission", nil)
+	req = req.WithContext(context.WithValue(req.Context(), guardtest.RequestKey{}, true))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Error("expecting the check to run with the context of the request, got", w.Code)
+	}
+}
@@ -0,0 +1,137 @@
+// Package authgrpc guards gRPC servers with AuthorizationGo permission checks
+package authgrpc
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	AuthorizationGo "github.com/SoegiDev/AuthorizationGo"
+	"github.com/SoegiDev/AuthorizationGo/internal/subject"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// MetadataKey is the incoming metadata key read by the default subject
+// extractor
+const MetadataKey = "x-user-id"
+
+var ErrMissingSubject = subject.ErrMissing
+
+// Registry maps fully-qualified method names, e.g. "/pkg.Service/Method", to
+// the permission required to call them. A "/pkg.Service/*" entry applies to
+// every method of the service without an entry of its own.
+type Registry map[string]string
+
+// Permission returns the permission required by the method
+func (r Registry) Permission(fullMethod string) (string, bool) {
+	if perm, ok := r[fullMethod]; ok {
+		return perm, true
+	}
+
+	if i := strings.LastIndex(fullMethod, "/"); i > 0 {
+		perm, ok := r[fullMethod[:i]+"/*"]
+		return perm, ok
+	}
+
+	return "", false
+}
+
+type Options struct {
+	// Permissions holds the permission required by each method
+	Permissions Registry
+	// AllowUnlisted lets calls to methods missing from Permissions through,
+	// by default they are denied
+	AllowUnlisted bool
+	// Subject returns the id of the caller, by default it reads MetadataKey
+	// from the incoming metadata
+	Subject func(ctx context.Context) (uint, error)
+	// OnError receives the errors of the permission checks, the caller only
+	// gets a generic Internal status so the cause is not leaked
+	OnError func(ctx context.Context, fullMethod string, err error)
+}
+
+type interceptor struct {
+	auth AuthorizationGo.Checker
+	opts Options
+}
+
+// UnaryServerInterceptor checks the permission of each unary call
+func UnaryServerInterceptor(auth AuthorizationGo.Checker, opts Options) grpc.UnaryServerInterceptor {
+	i := newInterceptor(auth, opts)
+
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := i.authorize(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor checks the permission of each stream when it is
+// opened
+func StreamServerInterceptor(auth AuthorizationGo.Checker, opts Options) grpc.StreamServerInterceptor {
+	i := newInterceptor(auth, opts)
+
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := i.authorize(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+
+		return handler(srv, ss)
+	}
+}
+
+func newInterceptor(auth AuthorizationGo.Checker, opts Options) *interceptor {
+	if opts.Subject == nil {
+		opts.Subject = defaultSubject
+	}
+
+	return &interceptor{auth: auth, opts: opts}
+}
+
+func (i *interceptor) authorize(ctx context.Context, fullMethod string) error {
+	permName, ok := i.opts.Permissions.Permission(fullMethod)
+	if !ok {
+		if i.opts.AllowUnlisted {
+			return nil
+		}
+		return status.Errorf(codes.PermissionDenied, "no permission registered for %s", fullMethod)
+	}
+
+	userID, err := i.opts.Subject(ctx)
+	if err != nil {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	ok, err = AuthorizationGo.CheckerWithContext(ctx, i.auth).CheckPermission(userID, permName)
+	if err != nil {
+		if i.opts.OnError != nil {
+			i.opts.OnError(ctx, fullMethod, err)
+		}
+		return status.Error(codes.Internal, "permission check failed")
+	}
+	if !ok {
+		return status.Errorf(codes.PermissionDenied, "missing permission %s", permName)
+	}
+
+	return nil
+}
+
+func defaultSubject(ctx context.Context) (uint, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(MetadataKey)
+	if len(values) == 0 {
+		return 0, ErrMissingSubject
+	}
+
+	userID, err := strconv.ParseUint(values[0], 10, 0)
+	if err != nil {
+		return 0, ErrMissingSubject
+	}
+
+	return uint(userID), nil
+}
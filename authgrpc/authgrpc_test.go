@@ -0,0 +1,180 @@
+package authgrpc_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	AuthorizationGo "github.com/SoegiDev/AuthorizationGo"
+	"github.com/SoegiDev/AuthorizationGo/authgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type checker struct{}
+
+func (checker) CheckPermission(userID uint, permName string) (bool, error) {
+	if userID == 3 {
+		return false, errors.New("broken check")
+	}
+	return userID == 1 && permName == "permission-a", nil
+}
+
+func (checker) CheckRole(userID uint, roleName string) (bool, error) {
+	return false, nil
+}
+
+// contextChecker only allows the checks made with the context of the call
+type contextChecker struct{ checker }
+
+func (contextChecker) CheckPermissionContext(ctx context.Context, userID uint, permName string) (bool, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return len(md.Get(authgrpc.MetadataKey)) > 0, nil
+}
+
+func (contextChecker) CheckRoleContext(ctx context.Context, userID uint, roleName string) (bool, error) {
+	return false, nil
+}
+
+func dial(t *testing.T, opts authgrpc.Options) healthpb.HealthClient {
+	return dialChecker(t, checker{}, opts)
+}
+
+func dialChecker(t *testing.T, auth AuthorizationGo.Checker, opts authgrpc.Options) healthpb.HealthClient {
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(authgrpc.UnaryServerInterceptor(auth, opts)),
+		grpc.StreamInterceptor(authgrpc.StreamServerInterceptor(auth, opts)),
+	)
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal("unexpected error while dialing.", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return healthpb.NewHealthClient(conn)
+}
+
+func asUser(userID string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), authgrpc.MetadataKey, userID)
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	client := dial(t, authgrpc.Options{
+		Permissions: authgrpc.Registry{
+			"/grpc.health.v1.Health/Check": "permission-a",
+		},
+	})
+
+	tests := []struct {
+		ctx  context.Context
+		code codes.Code
+	}{
+		{asUser("1"), codes.OK},
+		{asUser("2"), codes.PermissionDenied},
+		{asUser("3"), codes.Internal},
+		{context.Background(), codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		_, err := client.Check(tt.ctx, &healthpb.HealthCheckRequest{})
+		if status.Code(err) != tt.code {
+			t.Errorf("expecting code %s, got %s", tt.code, status.Code(err))
+		}
+	}
+}
+
+func TestCheckErrors(t *testing.T) {
+	var logged error
+	client := dial(t, authgrpc.Options{
+		Permissions: authgrpc.Registry{
+			"/grpc.health.v1.Health/Check": "permission-a",
+		},
+		OnError: func(ctx context.Context, fullMethod string, err error) {
+			logged = err
+		},
+	})
+
+	_, err := client.Check(asUser("3"), &healthpb.HealthCheckRequest{})
+	if status.Code(err) != codes.Internal {
+		t.Error("expecting Internal when the check fails, got", err)
+	}
+	if strings.Contains(status.Convert(err).Message(), "broken check") {
+		t.Error("expecting the cause of the failure not to be sent to the caller")
+	}
+	if logged == nil || logged.Error() != "broken check" {
+		t.Error("expecting OnError to receive the cause of the failure, got", logged)
+	}
+}
+
+func TestCheckContext(t *testing.T) {
+	client := dialChecker(t, contextChecker{}, authgrpc.Options{
+		Permissions: authgrpc.Registry{
+			"/grpc.health.v1.Health/Check": "permission-a",
+		},
+	})
+
+	_, err := client.Check(asUser("2"), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Error("expecting the check to run with the context of the call.", err)
+	}
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	client := dial(t, authgrpc.Options{
+		Permissions: authgrpc.Registry{
+			"/grpc.health.v1.Health/*": "permission-a",
+		},
+	})
+
+	// allowed stream
+	stream, err := client.Watch(asUser("1"), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal("unexpected error while opening stream.", err)
+	}
+	_, err = stream.Recv()
+	if err != nil {
+		t.Error("unexpected error while receiving from an allowed stream.", err)
+	}
+
+	// denied stream
+	stream, err = client.Watch(asUser("2"), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal("unexpected error while opening stream.", err)
+	}
+	_, err = stream.Recv()
+	if status.Code(err) != codes.PermissionDenied {
+		t.Error("expecting PermissionDenied on a denied stream, got", err)
+	}
+}
+
+func TestUnlistedMethods(t *testing.T) {
+	// denied by default
+	client := dial(t, authgrpc.Options{})
+	_, err := client.Check(asUser("1"), &healthpb.HealthCheckRequest{})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Error("expecting PermissionDenied for an unlisted method, got", err)
+	}
+
+	client = dial(t, authgrpc.Options{AllowUnlisted: true})
+	_, err = client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Error("expecting an unlisted method to be allowed.", err)
+	}
+}
@@ -1,8 +1,16 @@
 package AuthorizationGo
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
 )
 
 var tablePrefix string
@@ -10,39 +18,134 @@ var tablePrefix string
 // Authority helps deal with permissions
 type AuthorizationX struct {
 	DB *gorm.DB
+
+	events  *eventBus
+	busOnce sync.Once
+	outbox  bool
+	cache   *decisionCache
+	tracer  trace.Tracer
+	// ctx is the context of the spans, set by WithContext
+	ctx context.Context
+	// pending holds the events of a copy bound to a transaction
+	pending *[]Event
 }
 
 type AuthOption struct {
 	TablesPrefix string
 	DB           *gorm.DB
+	// Outbox records every change in the outbox table, in the transaction
+	// of the change, so a Relay can deliver them
+	Outbox bool
+	// TracerProvider creates the spans of the operations, nothing is traced
+	// by default
+	TracerProvider trace.TracerProvider
 }
 
 var (
-	ErrPermissionInUse     = errors.New("cannot delete assigned permission")
-	ErrPermissionNotFound  = errors.New("permission not found")
-	ErrRoleAlreadyAssigned = errors.New("this role is already assigned to the user")
-	ErrRoleInUse           = errors.New("cannot delete assigned role")
-	ErrRoleNotFound        = errors.New("role not found")
+	ErrAssignmentLimit         = errors.New("assignment limit reached")
+	ErrMissingPrerequisite     = errors.New("a prerequisite role is not assigned to the user")
+	ErrPermissionAlreadyExists = errors.New("permission already exists")
+	ErrPermissionInUse         = errors.New("cannot delete assigned permission")
+	ErrPermissionNotFound      = errors.New("permission not found")
+	ErrPrerequisiteCycle       = errors.New("prerequisite roles cannot form a cycle")
+	ErrReassignToSelf          = errors.New("cannot reassign to the deleted entry")
+	ErrRoleAlreadyAssigned     = errors.New("this role is already assigned to the user")
+	ErrRoleAlreadyExists       = errors.New("role already exists")
+	ErrRoleConflict            = errors.New("roles are mutually exclusive")
+	ErrRoleConflictWithSelf    = errors.New("a role cannot conflict with itself")
+	ErrRoleInUse               = errors.New("cannot delete assigned role")
+	ErrRoleNotAssigned         = errors.New("this role is not assigned to the user")
+	ErrRoleNotFound            = errors.New("role not found")
+	ErrRoleRequired            = errors.New("the role is a prerequisite of another role of the user")
 )
 
 var authGo *AuthorizationX
 
-// Initialization AuthorizationX
+// insertBatchSize is the number of rows inserted per statement by the bulk
+// operations, it keeps the statements below the placeholder limit of sqlite
+const insertBatchSize = 500
+
+// Initialization AuthorizationX, the tables are migrated and a migration error
+// is written to the logger of the DB, Migrate returns it
 func New(authOps AuthOption) *AuthorizationX {
 	tablePrefix = authOps.TablesPrefix
 	authGo = &AuthorizationX{
-		DB: authOps.DB,
+		DB:     authOps.DB,
+		events: newEventBus(),
+		outbox: authOps.Outbox,
+		tracer: newTracer(authOps.TracerProvider),
 	}
 
-	migrateTables(authOps.DB)
+	if err := migrateTables(authOps.DB); err != nil {
+		authOps.DB.Logger.Error(context.Background(), "AuthorizationGo: migrating the tables: %v", err)
+	}
 	return authGo
 }
 
-func migrateTables(db *gorm.DB) {
-	db.AutoMigrate(&Role{})
-	db.AutoMigrate(&Permission{})
-	db.AutoMigrate(&RolePermission{})
-	db.AutoMigrate(&UserRole{})
+// Migrate creates or updates the tables, it is called by New
+func (a *AuthorizationX) Migrate() (err error) {
+	op := a.startSpan("Migrate")
+	defer op.end(&err)
+
+	return migrateTables(a.DB)
+}
+
+func migrateTables(db *gorm.DB) error {
+	switch db.Dialector.Name() {
+	case "mysql":
+		// compare names case sensitively like postgres and sqlite do
+		db = db.Set("gorm:table_options", "ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin")
+	}
+
+	err := db.AutoMigrate(&Role{}, &Permission{}, &RolePermission{}, &UserRole{}, &RoleConflict{}, &RoleLimit{}, &UserLimit{}, &RolePrerequisite{}, &OutboxRecord{})
+	if err != nil {
+		return err
+	}
+
+	return uniqueActiveNames(db, tableName(db, Role{}), tableName(db, Permission{}))
+}
+
+// tableName returns the table of the model as gorm parsed it, gorm caches the
+// parsed models so it keeps the prefix given to the first New
+func tableName(db *gorm.DB, model schema.Tabler) string {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return model.TableName()
+	}
+
+	return stmt.Schema.Table
+}
+
+// uniqueActiveNames makes the names of the active rows of the tables unique so
+// concurrent creations and renames cannot duplicate them, the deleted rows
+// keep their names. It fails while a table has duplicate active names, which
+// the versions without the index could create.
+func uniqueActiveNames(db *gorm.DB, tables ...string) error {
+	for _, table := range tables {
+		index := table + "_active_name"
+		if db.Migrator().HasIndex(table, index) {
+			continue
+		}
+
+		query := "CREATE UNIQUE INDEX ? ON ? (name) WHERE deleted_at IS NULL"
+		if db.Dialector.Name() == "mysql" {
+			// mysql has no partial index, index a column which is null for the
+			// deleted rows instead
+			if !db.Migrator().HasColumn(table, "active_name") {
+				res := db.Exec("ALTER TABLE ? ADD COLUMN active_name VARCHAR(255) AS (IF(deleted_at IS NULL, name, NULL)) VIRTUAL", clause.Table{Name: table})
+				if res.Error != nil {
+					return res.Error
+				}
+			}
+			query = "CREATE UNIQUE INDEX ? ON ? (active_name)"
+		}
+
+		if err := db.Exec(query, clause.Column{Name: index}, clause.Table{Name: table}).Error; err != nil {
+			return fmt.Errorf("unique index on the active names of %s, delete or rename the duplicate names first: %w", table, err)
+		}
+	}
+
+	return nil
 }
 
 func Resolve() *AuthorizationX {
@@ -50,102 +153,148 @@ func Resolve() *AuthorizationX {
 }
 
 // Create Role User
-func (a *AuthorizationX) CreateRole(roleName string) error {
+func (a *AuthorizationX) CreateRole(roleName string) (err error) {
+	op := a.startSpan("CreateRole", roleAttr(roleName))
+	defer op.end(&err)
+
 	var dbRole Role
 	res := a.DB.Where("name = ?", roleName).First(&dbRole)
 	if res.Error != nil {
 		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
 			// create
-			a.DB.Create(&Role{Name: roleName})
-			return nil
+			events := []Event{{Type: RoleCreated, Role: roleName}}
+			return a.mutate(&events, func(tx *gorm.DB) error {
+				return tx.Create(&Role{Name: roleName}).Error
+			})
 		}
 	}
 
 	return res.Error
 }
 
-func (a *AuthorizationX) CreatePermission(permName string) error {
+func (a *AuthorizationX) CreatePermission(permName string) (err error) {
+	op := a.startSpan("CreatePermission", permissionAttr(permName))
+	defer op.end(&err)
+
 	var dbPerm Permission
 	res := a.DB.Where("name = ?", permName).First(&dbPerm)
 	if res.Error != nil {
 		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
 			// create
-			a.DB.Create(&Permission{Name: permName})
-			return nil
+			events := []Event{{Type: PermissionCreated, Permission: permName}}
+			return a.mutate(&events, func(tx *gorm.DB) error {
+				return tx.Create(&Permission{Name: permName}).Error
+			})
 		}
 	}
 
 	return res.Error
 }
 
-func (a *AuthorizationX) AssignPermissions(roleName string, permNames []string) error {
-	// get the role id
-	var role Role
-	rRes := a.DB.Where("name = ?", roleName).First(&role)
-	if rRes.Error != nil {
-		if errors.Is(rRes.Error, gorm.ErrRecordNotFound) {
-			return ErrRoleNotFound
-		}
-
-	}
+// AssignPermissions grants the permissions to the role, permissions already
+// granted are ignored and the missing ones are inserted at once
+func (a *AuthorizationX) AssignPermissions(roleName string, permNames []string) (err error) {
+	op := a.startSpan("AssignPermissions", roleAttr(roleName), permissionsAttr(permNames))
+	defer op.end(&err)
 
-	var perms []Permission
-	// get the permissions ids
-	for _, permName := range permNames {
-		var perm Permission
-		pRes := a.DB.Where("name = ?", permName).First(&perm)
-		if pRes.Error != nil {
-			if errors.Is(pRes.Error, gorm.ErrRecordNotFound) {
-				return ErrPermissionNotFound
+	var events []Event
+	return a.mutate(&events, func(tx *gorm.DB) error {
+		// get the role id
+		var role Role
+		rRes := tx.Where("name = ?", roleName).First(&role)
+		if rRes.Error != nil {
+			if errors.Is(rRes.Error, gorm.ErrRecordNotFound) {
+				return ErrRoleNotFound
 			}
+			return rRes.Error
+		}
 
+		if len(permNames) == 0 {
+			return nil
 		}
 
-		perms = append(perms, perm)
-	}
+		// get the permissions
+		perms, err := findPermissions(tx, permNames)
+		if err != nil {
+			return err
+		}
 
-	// insert data into RolePermissions table
-	for _, perm := range perms {
 		// ignore any assigned permission
-		var rolePerm RolePermission
-		res := a.DB.Where("role_id = ?", role.ID).Where("permission_id =?", perm.ID).First(&rolePerm)
+		var assigned []uint
+		res := tx.Model(&RolePermission{}).Where("role_id = ?", role.ID).Where("permission_id IN (?)", permissionIDs(perms)).Pluck("permission_id", &assigned)
 		if res.Error != nil {
-			// assign the record
-			cRes := a.DB.Create(&RolePermission{RoleID: role.ID, PermissionID: perm.ID})
-			if cRes.Error != nil {
-				return cRes.Error
+			return res.Error
+		}
+		isAssigned := make(map[uint]bool, len(assigned))
+		for _, id := range assigned {
+			isAssigned[id] = true
+		}
+
+		var rolePerms []RolePermission
+		for _, perm := range perms {
+			if !isAssigned[perm.ID] {
+				rolePerms = append(rolePerms, RolePermission{RoleID: role.ID, PermissionID: perm.ID})
+				events = append(events, Event{Type: PermissionGranted, Role: roleName, Permission: perm.Name})
 			}
 		}
-	}
+		if len(rolePerms) == 0 {
+			return nil
+		}
 
-	return nil
+		// insert data into RolePermissions table
+		return tx.CreateInBatches(rolePerms, insertBatchSize).Error
+	})
 }
 
-func (a *AuthorizationX) AssignRole(userID uint, roleName string) error {
-	// make sure the role exist
-	var role Role
-	res := a.DB.Where("name = ?", roleName).First(&role)
-	if res.Error != nil {
-		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
-			return ErrRoleNotFound
+func (a *AuthorizationX) AssignRole(userID uint, roleName string) (err error) {
+	op := a.startSpan("AssignRole", userAttr(userID), roleAttr(roleName))
+	defer op.end(&err)
+
+	var events []Event
+	return a.mutate(&events, func(tx *gorm.DB) error {
+		// make sure the role exist
+		var role Role
+		res := tx.Where("name = ?", roleName).First(&role)
+		if res.Error != nil {
+			if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+				return ErrRoleNotFound
+			}
+			return res.Error
 		}
-	}
 
-	// check if the role is already assigned
-	var userRole UserRole
-	res = a.DB.Where("user_id = ?", userID).Where("role_id = ?", role.ID).First(&userRole)
-	if res.Error == nil {
-		//found a record, this role is already assigned to the same user
-		return ErrRoleAlreadyAssigned
-	}
+		// check if the role is already assigned
+		var userRole UserRole
+		res = tx.Where("user_id = ?", userID).Where("role_id = ?", role.ID).First(&userRole)
+		if res.Error == nil {
+			//found a record, this role is already assigned to the same user
+			return ErrRoleAlreadyAssigned
+		}
 
-	// assign the role
-	a.DB.Create(&UserRole{UserID: userID, RoleID: role.ID})
+		// assign the role
+		created, err := assignUserRoles(tx, []uint{userID}, []Role{role})
+		events = roleAssignedEvents(created, []Role{role})
+		return err
+	})
+}
 
-	return nil
+func (a *AuthorizationX) CheckRole(userID uint, roleName string) (allowed bool, err error) {
+	op := a.startSpan("CheckRole", userAttr(userID), roleAttr(roleName))
+	defer op.endCheck(&allowed, &err)
+
+	start := time.Now()
+	v, status, err := a.cached(userID, "role:"+roleName, func() (verdict, error) {
+		ok, err := a.checkRole(userID, roleName)
+		if !ok {
+			return verdict{}, err
+		}
+		return verdict{allowed: true, role: roleName}, err
+	})
+	a.observe(Decision{Check: RoleCheck, UserID: userID, Role: roleName, Allowed: v.allowed, MatchedRole: v.role, Err: err, Cache: status, Duration: time.Since(start)})
+
+	return v.allowed, err
 }
 
-func (a *AuthorizationX) CheckRole(userID uint, roleName string) (bool, error) {
+func (a *AuthorizationX) checkRole(userID uint, roleName string) (bool, error) {
 	// find the role
 	var role Role
 	res := a.DB.Where("name = ?", roleName).First(&role)
@@ -169,43 +318,76 @@ func (a *AuthorizationX) CheckRole(userID uint, roleName string) (bool, error) {
 	return true, nil
 }
 
-func (a *AuthorizationX) CheckPermission(userID uint, permName string) (bool, error) {
-	// the user role
-	var userRoles []UserRole
-	res := a.DB.Where("user_id = ?", userID).Find(&userRoles)
+// CheckPermission tells if one of the active roles of the user grants the
+// permission, it is resolved in a single query which also finds the first
+// granting role for the decision hooks
+func (a *AuthorizationX) CheckPermission(userID uint, permName string) (allowed bool, err error) {
+	op := a.startSpan("CheckPermission", userAttr(userID), permissionAttr(permName))
+	defer op.endCheck(&allowed, &err)
+
+	start := time.Now()
+	v, status, err := a.cached(userID, "permission:"+permName, func() (verdict, error) {
+		return a.checkPermission(userID, permName, nil)
+	})
+	a.observe(Decision{Check: PermissionCheck, UserID: userID, Permission: permName, Allowed: v.allowed, MatchedRole: v.role, Err: err, Cache: status, Duration: time.Since(start)})
+
+	return v.allowed, err
+}
+
+// checkPermission finds the first role of the user granting the permission,
+// among the given roles unless they are nil
+func (a *AuthorizationX) checkPermission(userID uint, permName string, roleIDs []uint) (verdict, error) {
+	roles := a.DB.Statement.Quote(tableName(a.DB, Role{}))
+	perms := a.DB.Statement.Quote(tableName(a.DB, Permission{}))
+	rolePerms := a.DB.Statement.Quote(tableName(a.DB, RolePermission{}))
+	userRoles := a.DB.Statement.Quote(tableName(a.DB, UserRole{}))
+
+	// find the permission along with the first role of the user granting it
+	var result struct {
+		ID          uint
+		MatchedRole *string
+	}
+	filter, args := "", []interface{}{userID}
+	if roleIDs != nil {
+		filter, args = " AND "+userRoles+".role_id IN (?)", append(args, roleIDs)
+	}
+	res := a.DB.Model(&Permission{}).
+		Select(perms+".id, (SELECT "+roles+".name FROM "+userRoles+
+			" JOIN "+rolePerms+" ON "+rolePerms+".role_id = "+userRoles+".role_id"+
+			" JOIN "+roles+" ON "+roles+".id = "+userRoles+".role_id AND "+roles+".deleted_at IS NULL"+
+			" WHERE "+userRoles+".user_id = ?"+filter+" AND "+rolePerms+".permission_id = "+perms+".id"+
+			" ORDER BY "+roles+".name LIMIT 1) AS matched_role", args...).
+		Where(perms+".name = ?", permName).
+		Take(&result)
 	if res.Error != nil {
 		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
-			return false, nil
+			return verdict{}, ErrPermissionNotFound
 		}
+		return verdict{}, res.Error
 	}
-
-	//prepare an array of role ids
-	var roleIDs []uint
-	for _, r := range userRoles {
-		roleIDs = append(roleIDs, r.RoleID)
+	if result.MatchedRole == nil {
+		return verdict{}, nil
 	}
 
-	// find the permission
-	var perm Permission
-	res = a.DB.Where("name = ?", permName).First(&perm)
-	if res.Error != nil {
-		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
-			return false, ErrPermissionNotFound
-		}
+	return verdict{allowed: true, role: *result.MatchedRole}, nil
+}
 
-	}
+func (a *AuthorizationX) CheckRolePermission(roleName string, permName string) (allowed bool, err error) {
+	op := a.startSpan("CheckRolePermission", roleAttr(roleName), permissionAttr(permName))
+	defer op.endCheck(&allowed, &err)
 
-	// find the role permission
-	var rolePermission RolePermission
-	res = a.DB.Where("role_id IN (?)", roleIDs).Where("permission_id = ?", perm.ID).First(&rolePermission)
-	if res.Error != nil {
-		return false, nil
+	start := time.Now()
+	allowed, err = a.checkRolePermission(roleName, permName)
+	d := Decision{Check: RolePermissionCheck, Role: roleName, Permission: permName, Allowed: allowed, Err: err, Duration: time.Since(start)}
+	if allowed {
+		d.MatchedRole = roleName
 	}
+	a.observe(d)
 
-	return true, nil
+	return allowed, err
 }
 
-func (a *AuthorizationX) CheckRolePermission(roleName string, permName string) (bool, error) {
+func (a *AuthorizationX) checkRolePermission(roleName string, permName string) (bool, error) {
 	// find the role
 	var role Role
 	res := a.DB.Where("name = ?", roleName).First(&role)
@@ -239,7 +421,14 @@ func (a *AuthorizationX) CheckRolePermission(roleName string, permName string) (
 	return true, nil
 }
 
-func (a *AuthorizationX) RevokeRole(userID uint, roleName string) error {
+// RevokeRole revokes the role from the user, it fails with ErrRoleRequired when
+// another role of the user requires it unless WithDependentRoles is given
+func (a *AuthorizationX) RevokeRole(userID uint, roleName string, opts ...RevokeOption) (err error) {
+	op := a.startSpan("RevokeRole", userAttr(userID), roleAttr(roleName))
+	defer op.end(&err)
+
+	options := newRevokeOptions(opts)
+
 	// find the role
 	var role Role
 	res := a.DB.Where("name = ?", roleName).First(&role)
@@ -251,42 +440,62 @@ func (a *AuthorizationX) RevokeRole(userID uint, roleName string) error {
 	}
 
 	// revoke the role
-	a.DB.Where("user_id = ?", userID).Where("role_id = ?", role.ID).Delete(UserRole{})
-
-	return nil
-}
-
-func (a *AuthorizationX) RevokePermission(userID uint, permName string) error {
-	// revoke the permission from all roles of the user
-	// find the user roles
-	var userRoles []UserRole
-	res := a.DB.Where("user_id = ?", userID).Find(&userRoles)
-	if res.Error != nil {
-		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+	var events []Event
+	return a.mutate(&events, func(tx *gorm.DB) error {
+		res := tx.Where("user_id = ?", userID).Where("role_id = ?", role.ID).Delete(UserRole{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
 			return nil
 		}
+		events = append(events, Event{Type: RoleRevoked, Role: roleName, UserID: userID})
 
-	}
+		dependents, err := revokeDependents(tx, userID, []uint{role.ID}, options.dependents)
+		events = append(events, dependents...)
+		return err
+	})
+}
+
+func (a *AuthorizationX) RevokePermission(userID uint, permName string) (err error) {
+	op := a.startSpan("RevokePermission", userAttr(userID), permissionAttr(permName))
+	defer op.end(&err)
 
 	// find the permission
 	var perm Permission
-	res = a.DB.Where("name = ?", permName).First(&perm)
+	res := a.DB.Where("name = ?", permName).First(&perm)
 	if res.Error != nil {
 		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
 			return ErrPermissionNotFound
 		}
-
+		return res.Error
 	}
 
-	for _, r := range userRoles {
-		// revoke the permission
-		a.DB.Where("role_id = ?", r.RoleID).Where("permission_id = ?", perm.ID).Delete(RolePermission{})
-	}
+	// revoke the permission from all roles of the user
+	var events []Event
+	return a.mutate(&events, func(tx *gorm.DB) error {
+		userRoles := tx.Model(&UserRole{}).Select("role_id").Where("user_id = ?", userID)
+
+		var roleNames []string
+		res := tx.Model(&Role{}).
+			Where("id IN (?)", userRoles).
+			Where("id IN (?)", tx.Model(&RolePermission{}).Select("role_id").Where("permission_id = ?", perm.ID)).
+			Pluck("name", &roleNames)
+		if res.Error != nil {
+			return res.Error
+		}
+		for _, name := range roleNames {
+			events = append(events, Event{Type: PermissionRevoked, Role: name, Permission: permName})
+		}
 
-	return nil
+		return tx.Where("permission_id = ?", perm.ID).Where("role_id IN (?)", userRoles).Delete(RolePermission{}).Error
+	})
 }
 
-func (a *AuthorizationX) RevokeRolePermission(roleName string, permName string) error {
+func (a *AuthorizationX) RevokeRolePermission(roleName string, permName string) (err error) {
+	op := a.startSpan("RevokeRolePermission", roleAttr(roleName), permissionAttr(permName))
+	defer op.end(&err)
+
 	// find the role
 	var role Role
 	res := a.DB.Where("name = ?", roleName).First(&role)
@@ -308,101 +517,667 @@ func (a *AuthorizationX) RevokeRolePermission(roleName string, permName string)
 	}
 
 	// revoke the permission
-	a.DB.Where("role_id = ?", role.ID).Where("permission_id = ?", perm.ID).Delete(RolePermission{})
+	var events []Event
+	return a.mutate(&events, func(tx *gorm.DB) error {
+		res := tx.Where("role_id = ?", role.ID).Where("permission_id = ?", perm.ID).Delete(RolePermission{})
+		if res.RowsAffected > 0 {
+			events = append(events, Event{Type: PermissionRevoked, Role: roleName, Permission: permName})
+		}
+		return res.Error
+	})
+}
 
-	return nil
+func (a *AuthorizationX) GetRoles() (names []string, err error) {
+	op := a.startSpan("GetRoles")
+	defer op.end(&err)
+
+	var result []string
+	res := a.DB.Model(&Role{}).Pluck("name", &result)
+
+	return result, res.Error
 }
 
-func (a *AuthorizationX) GetRoles() ([]string, error) {
+// GetUserRoles returns the names of the roles assigned to the user, use
+// ListUserRoles to paginate them
+func (a *AuthorizationX) GetUserRoles(userID uint) (names []string, err error) {
+	op := a.startSpan("GetUserRoles", userAttr(userID))
+	defer op.end(&err)
+
+	return a.WithContext(op.ctx).ListUserRoles(userID, ListOptions{})
+}
+
+func (a *AuthorizationX) GetPermissions() (names []string, err error) {
+	op := a.startSpan("GetPermissions")
+	defer op.end(&err)
+
 	var result []string
-	var roles []Role
-	a.DB.Find(&roles)
+	res := a.DB.Model(&Permission{}).Pluck("name", &result)
+
+	return result, res.Error
+}
+
+// DeleteRole soft deletes a role, by default it refuses to delete a role
+// assigned to users, use WithCascade, WithReassignTo or WithForce to deal with
+// the assignments and WithPurge to delete it permanently
+func (a *AuthorizationX) DeleteRole(roleName string, opts ...DeleteOption) error {
+	_, err := a.DeleteRoleCount(roleName, opts...)
+	return err
+}
+
+// DeleteRoleCount is DeleteRole returning the number of user assignments
+// revoked or moved to another role, the grants of a purged role are not
+// counted
+func (a *AuthorizationX) DeleteRoleCount(roleName string, opts ...DeleteOption) (affected int64, err error) {
+	op := a.startSpan("DeleteRole", roleAttr(roleName))
+	defer op.end(&err)
+
+	options := newDeleteOptions(opts)
 
-	for _, role := range roles {
-		result = append(result, role.Name)
+	var events []Event
+	err = a.mutate(&events, func(tx *gorm.DB) error {
+		// find the role
+		var role Role
+		res := tx.Where("name = ?", roleName).First(&role)
+		if res.Error != nil {
+			if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+				return ErrRoleNotFound
+			}
+			return res.Error
+		}
+
+		switch {
+		case options.reassignTo != "":
+			if options.reassignTo == roleName {
+				return ErrReassignToSelf
+			}
+
+			// find the target role
+			var target Role
+			res = tx.Where("name = ?", options.reassignTo).First(&target)
+			if res.Error != nil {
+				if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+					return ErrRoleNotFound
+				}
+				return res.Error
+			}
+
+			// drop the assignments of users already holding the target role
+			var userIDs []uint
+			res = tx.Model(&UserRole{}).Where("role_id = ?", target.ID).Pluck("user_id", &userIDs)
+			if res.Error != nil {
+				return res.Error
+			}
+			holders, err := roleHolders(tx, role.ID)
+			if err != nil {
+				return err
+			}
+			hasTarget := make(map[uint]bool, len(userIDs))
+			for _, id := range userIDs {
+				hasTarget[id] = true
+			}
+			var moved []uint
+			for _, id := range holders {
+				events = append(events, Event{Type: RoleRevoked, Role: roleName, UserID: id})
+				if !hasTarget[id] {
+					moved = append(moved, id)
+					events = append(events, Event{Type: RoleAssigned, Role: target.Name, UserID: id})
+				}
+			}
+			if err := checkRoleConflicts(tx, moved, []uint{target.ID}, role.ID); err != nil {
+				return err
+			}
+			movedRoles := make([]UserRole, len(moved))
+			for i, id := range moved {
+				movedRoles[i] = UserRole{UserID: id, RoleID: target.ID}
+			}
+			if err := checkAssignmentLimits(tx, movedRoles, role.ID); err != nil {
+				return err
+			}
+			if err := checkPrerequisites(tx, moved, []uint{target.ID}, role.ID); err != nil {
+				return err
+			}
+			if len(userIDs) > 0 {
+				res = tx.Where("role_id = ?", role.ID).Where("user_id IN (?)", userIDs).Delete(UserRole{})
+				if res.Error != nil {
+					return res.Error
+				}
+				affected += res.RowsAffected
+			}
+
+			// move the remaining assignments to the target role
+			res = tx.Model(&UserRole{}).Where("role_id = ?", role.ID).Update("role_id", target.ID)
+			if res.Error != nil {
+				return res.Error
+			}
+			affected += res.RowsAffected
+
+			// the target role does not stand in for the deleted one as a
+			// prerequisite
+			for _, id := range holders {
+				if _, err := revokeDependents(tx, id, []uint{role.ID}, false); err != nil {
+					return err
+				}
+			}
+		case options.cascade:
+			// revoke the role from all users
+			holders, err := roleHolders(tx, role.ID)
+			if err != nil {
+				return err
+			}
+			for _, id := range holders {
+				events = append(events, Event{Type: RoleRevoked, Role: roleName, UserID: id})
+			}
+			res = tx.Where("role_id = ?", role.ID).Delete(UserRole{})
+			if res.Error != nil {
+				return res.Error
+			}
+			affected += res.RowsAffected
+
+			// along with the roles requiring it
+			for _, id := range holders {
+				dependents, err := revokeDependents(tx, id, []uint{role.ID}, true)
+				if err != nil {
+					return err
+				}
+				events = append(events, dependents...)
+				affected += int64(len(dependents))
+			}
+		case !options.force:
+			// check if the role is assigned to a user
+			var userRole UserRole
+			res = tx.Where("role_id = ?", role.ID).First(&userRole)
+			if res.Error == nil {
+				// role is assigned
+				return ErrRoleInUse
+			}
+		}
+
+		events = append(events, Event{Type: RoleDeleted, Role: roleName})
+		if !options.purge {
+			// soft delete the role, the remaining assignments are kept so
+			// RestoreRole can bring them back
+			return tx.Where("id = ?", role.ID).Delete(&Role{}).Error
+		}
+
+		// revoke the remaining assignments before deleting the role
+		holders, err := roleHolders(tx, role.ID)
+		if err != nil {
+			return err
+		}
+		for _, id := range holders {
+			events = append(events, Event{Type: RoleRevoked, Role: roleName, UserID: id})
+		}
+		res = tx.Where("role_id = ?", role.ID).Delete(UserRole{})
+		if res.Error != nil {
+			return res.Error
+		}
+		affected += res.RowsAffected
+		res = tx.Where("role_id = ?", role.ID).Delete(RolePermission{})
+		if res.Error != nil {
+			return res.Error
+		}
+		res = tx.Where("role_id = ? OR conflicting_role_id = ?", role.ID, role.ID).Delete(RoleConflict{})
+		if res.Error != nil {
+			return res.Error
+		}
+		res = tx.Where("role_id = ?", role.ID).Delete(RoleLimit{})
+		if res.Error != nil {
+			return res.Error
+		}
+		res = tx.Where("role_id = ? OR prerequisite_role_id = ?", role.ID, role.ID).Delete(RolePrerequisite{})
+		if res.Error != nil {
+			return res.Error
+		}
+
+		// delete the role
+		return tx.Unscoped().Where("id = ?", role.ID).Delete(&Role{}).Error
+	})
+	if err != nil {
+		return 0, err
 	}
 
-	return result, nil
+	return affected, nil
 }
 
-func (a *AuthorizationX) GetUserRoles(userID uint) ([]string, error) {
-	var result []string
-	var userRoles []UserRole
-	a.DB.Where("user_id = ?", userID).Find(&userRoles)
+// DeletePermission soft deletes a permission, by default it refuses to delete a
+// permission granted to roles, use WithCascade, WithReassignTo or WithForce to
+// deal with the grants and WithPurge to delete it permanently
+func (a *AuthorizationX) DeletePermission(permName string, opts ...DeleteOption) error {
+	_, err := a.DeletePermissionCount(permName, opts...)
+	return err
+}
+
+// DeletePermissionCount is DeletePermission returning the number of grants
+// revoked or moved to another permission
+func (a *AuthorizationX) DeletePermissionCount(permName string, opts ...DeleteOption) (affected int64, err error) {
+	op := a.startSpan("DeletePermission", permissionAttr(permName))
+	defer op.end(&err)
+
+	options := newDeleteOptions(opts)
+
+	var events []Event
+	err = a.mutate(&events, func(tx *gorm.DB) error {
+		// find the permission
+		var perm Permission
+		res := tx.Where("name = ?", permName).First(&perm)
+		if res.Error != nil {
+			if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+				return ErrPermissionNotFound
+			}
+			return res.Error
+		}
+
+		switch {
+		case options.reassignTo != "":
+			if options.reassignTo == permName {
+				return ErrReassignToSelf
+			}
+
+			// find the target permission
+			var target Permission
+			res = tx.Where("name = ?", options.reassignTo).First(&target)
+			if res.Error != nil {
+				if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+					return ErrPermissionNotFound
+				}
+				return res.Error
+			}
+
+			// drop the grants of roles already holding the target permission
+			var roleIDs []uint
+			res = tx.Model(&RolePermission{}).Where("permission_id = ?", target.ID).Pluck("role_id", &roleIDs)
+			if res.Error != nil {
+				return res.Error
+			}
+			grantees, err := permissionGrantees(tx, perm.ID)
+			if err != nil {
+				return err
+			}
+			targetGrantees, err := permissionGrantees(tx, target.ID)
+			if err != nil {
+				return err
+			}
+			hasTarget := make(map[string]bool, len(targetGrantees))
+			for _, name := range targetGrantees {
+				hasTarget[name] = true
+			}
+			for _, name := range grantees {
+				events = append(events, Event{Type: PermissionRevoked, Role: name, Permission: permName})
+				if !hasTarget[name] {
+					events = append(events, Event{Type: PermissionGranted, Role: name, Permission: target.Name})
+				}
+			}
+			if len(roleIDs) > 0 {
+				res = tx.Where("permission_id = ?", perm.ID).Where("role_id IN (?)", roleIDs).Delete(RolePermission{})
+				if res.Error != nil {
+					return res.Error
+				}
+				affected += res.RowsAffected
+			}
 
-	for _, r := range userRoles {
+			// move the remaining grants to the target permission
+			res = tx.Model(&RolePermission{}).Where("permission_id = ?", perm.ID).Update("permission_id", target.ID)
+			if res.Error != nil {
+				return res.Error
+			}
+			affected += res.RowsAffected
+		case options.cascade:
+			// revoke the permission from all roles
+			grantees, err := permissionGrantees(tx, perm.ID)
+			if err != nil {
+				return err
+			}
+			for _, name := range grantees {
+				events = append(events, Event{Type: PermissionRevoked, Role: name, Permission: permName})
+			}
+			res = tx.Where("permission_id = ?", perm.ID).Delete(RolePermission{})
+			if res.Error != nil {
+				return res.Error
+			}
+			affected += res.RowsAffected
+		case !options.force:
+			// check if the permission is assigned to a role, grants of
+			// deleted roles do not count
+			var rolePermission RolePermission
+			res = tx.Where("permission_id = ?", perm.ID).
+				Where("role_id IN (?)", tx.Model(&Role{}).Select("id")).
+				First(&rolePermission)
+			if res.Error == nil {
+				// permission is assigned
+				return ErrPermissionInUse
+			}
+		}
+
+		events = append(events, Event{Type: PermissionDeleted, Permission: permName})
+		if !options.purge {
+			// soft delete the permission, the remaining grants are kept so
+			// RestorePermission can bring them back
+			return tx.Where("id = ?", perm.ID).Delete(&Permission{}).Error
+		}
+
+		// revoke the remaining grants before deleting the permission
+		grantees, err := permissionGrantees(tx, perm.ID)
+		if err != nil {
+			return err
+		}
+		for _, name := range grantees {
+			events = append(events, Event{Type: PermissionRevoked, Role: name, Permission: permName})
+		}
+		res = tx.Where("permission_id = ?", perm.ID).Delete(RolePermission{})
+		if res.Error != nil {
+			return res.Error
+		}
+		affected += res.RowsAffected
+
+		// delete the permission
+		return tx.Unscoped().Where("id = ?", perm.ID).Delete(&Permission{}).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return affected, nil
+}
+
+// RenameRole changes the name of a role, assignments and permissions are kept
+// since they reference the role by id
+func (a *AuthorizationX) RenameRole(oldName string, newName string) (err error) {
+	op := a.startSpan("RenameRole", roleAttr(oldName), newNameAttr(newName))
+	defer op.end(&err)
+
+	var events []Event
+	return a.mutate(&events, func(tx *gorm.DB) error {
+		// find the role
 		var role Role
-		// for every user role get the role name
-		res := a.DB.Where("id = ?", r.RoleID).Find(&role)
+		res := tx.Where("name = ?", oldName).First(&role)
+		if res.Error != nil {
+			if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+				return ErrRoleNotFound
+			}
+			return res.Error
+		}
+
+		if oldName == newName {
+			return nil
+		}
+
+		// make sure the new name is not taken, the unique index on the active
+		// names catches concurrent renames
+		var dbRole Role
+		res = tx.Where("name = ?", newName).First(&dbRole)
 		if res.Error == nil {
-			result = append(result, role.Name)
+			return ErrRoleAlreadyExists
+		}
+		if !errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return res.Error
+		}
+
+		// rename the role
+		events = append(events, Event{Type: RoleRenamed, Role: oldName, NewName: newName})
+		return tx.Model(&role).Update("name", newName).Error
+	})
+}
+
+// RenamePermission changes the name of a permission, role grants are kept
+// since they reference the permission by id
+func (a *AuthorizationX) RenamePermission(oldName string, newName string) (err error) {
+	op := a.startSpan("RenamePermission", permissionAttr(oldName), newNameAttr(newName))
+	defer op.end(&err)
+
+	var events []Event
+	return a.mutate(&events, func(tx *gorm.DB) error {
+		// find the permission
+		var perm Permission
+		res := tx.Where("name = ?", oldName).First(&perm)
+		if res.Error != nil {
+			if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+				return ErrPermissionNotFound
+			}
+			return res.Error
+		}
+
+		if oldName == newName {
+			return nil
+		}
+
+		// make sure the new name is not taken, the unique index on the active
+		// names catches concurrent renames
+		var dbPerm Permission
+		res = tx.Where("name = ?", newName).First(&dbPerm)
+		if res.Error == nil {
+			return ErrPermissionAlreadyExists
+		}
+		if !errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return res.Error
+		}
+
+		// rename the permission
+		events = append(events, Event{Type: PermissionRenamed, Permission: oldName, NewName: newName})
+		return tx.Model(&perm).Update("name", newName).Error
+	})
+}
+
+// RestoreRole restores a soft deleted role along with the assignments and
+// permissions it had when it was deleted, it fails with ErrRoleConflict when
+// one of its holders got a mutually exclusive role in the meantime
+func (a *AuthorizationX) RestoreRole(roleName string) (err error) {
+	op := a.startSpan("RestoreRole", roleAttr(roleName))
+	defer op.end(&err)
+
+	// make sure the name is not taken by an active role
+	var dbRole Role
+	res := a.DB.Where("name = ?", roleName).First(&dbRole)
+	if res.Error == nil {
+		return ErrRoleAlreadyExists
+	}
+	if !errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return res.Error
+	}
+
+	// find the latest deleted role
+	var role Role
+	res = a.DB.Unscoped().Where("name = ?", roleName).Where("deleted_at IS NOT NULL").Order("deleted_at DESC").First(&role)
+	if res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return ErrRoleNotFound
 		}
+		return res.Error
 	}
 
-	return result, nil
+	// restore the role
+	events := []Event{{Type: RoleRestored, Role: roleName}}
+	return a.mutate(&events, func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&role).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+
+		// the kept assignments must not conflict with the roles of the users
+		// and must have their prerequisites
+		holders, err := roleHolders(tx, role.ID)
+		if err != nil {
+			return err
+		}
+		if err := checkRoleConflicts(tx, holders, []uint{role.ID}, 0); err != nil {
+			return err
+		}
+		if err := checkPrerequisites(tx, holders, []uint{role.ID}, 0); err != nil {
+			return err
+		}
+
+		// the roles requiring the restored role may have been assigned
+		// without it while it was deleted
+		return checkDependents(tx, role)
+	})
 }
 
-func (a *AuthorizationX) GetPermissions() ([]string, error) {
-	var result []string
-	var perms []Permission
-	a.DB.Find(&perms)
+// RestorePermission restores a soft deleted permission along with the grants
+// it had when it was deleted
+func (a *AuthorizationX) RestorePermission(permName string) (err error) {
+	op := a.startSpan("RestorePermission", permissionAttr(permName))
+	defer op.end(&err)
+
+	// make sure the name is not taken by an active permission
+	var dbPerm Permission
+	res := a.DB.Where("name = ?", permName).First(&dbPerm)
+	if res.Error == nil {
+		return ErrPermissionAlreadyExists
+	}
+	if !errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return res.Error
+	}
 
-	for _, perm := range perms {
-		result = append(result, perm.Name)
+	// find the latest deleted permission
+	var perm Permission
+	res = a.DB.Unscoped().Where("name = ?", permName).Where("deleted_at IS NOT NULL").Order("deleted_at DESC").First(&perm)
+	if res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return ErrPermissionNotFound
+		}
+		return res.Error
 	}
 
-	return result, nil
+	// restore the permission
+	events := []Event{{Type: PermissionRestored, Permission: permName}}
+	return a.mutate(&events, func(tx *gorm.DB) error {
+		return tx.Unscoped().Model(&perm).Update("deleted_at", nil).Error
+	})
+}
+
+// ListRoles returns a page of role names
+func (a *AuthorizationX) ListRoles(opts ListOptions) (names []string, err error) {
+	op := a.startSpan("ListRoles")
+	defer op.end(&err)
+
+	var result []string
+	res := opts.apply(a.DB.Model(&Role{}), "name", "id").Pluck("name", &result)
+
+	return result, res.Error
 }
 
-func (a *AuthorizationX) DeleteRole(roleName string) error {
+// ListPermissions returns a page of permission names
+func (a *AuthorizationX) ListPermissions(opts ListOptions) (names []string, err error) {
+	op := a.startSpan("ListPermissions")
+	defer op.end(&err)
+
+	var result []string
+	res := opts.apply(a.DB.Model(&Permission{}), "name", "id").Pluck("name", &result)
+
+	return result, res.Error
+}
+
+// ListUserRoles returns a page of the role names assigned to the user
+func (a *AuthorizationX) ListUserRoles(userID uint, opts ListOptions) (names []string, err error) {
+	op := a.startSpan("ListUserRoles", userAttr(userID))
+	defer op.end(&err)
+
+	roles := a.DB.Statement.Quote(tableName(a.DB, Role{}))
+	userRoles := a.DB.Statement.Quote(tableName(a.DB, UserRole{}))
+
+	var result []string
+	query := a.DB.Model(&Role{}).
+		Joins("JOIN "+userRoles+" ON "+userRoles+".role_id = "+roles+".id").
+		Where(userRoles+".user_id = ?", userID)
+	res := opts.apply(query, roles+".name", roles+".id").Pluck(roles+".name", &result)
+
+	return result, res.Error
+}
+
+// ListUsersWithRole returns a page of the user ids the role is assigned to,
+// the name filters do not apply and name sorting falls back to the user id
+func (a *AuthorizationX) ListUsersWithRole(roleName string, opts ListOptions) (userIDs []uint, err error) {
+	op := a.startSpan("ListUsersWithRole", roleAttr(roleName))
+	defer op.end(&err)
+
 	// find the role
 	var role Role
 	res := a.DB.Where("name = ?", roleName).First(&role)
 	if res.Error != nil {
 		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
-			return ErrRoleNotFound
+			return nil, ErrRoleNotFound
 		}
-
+		return nil, res.Error
 	}
 
-	// check if the role is assigned to a user
-	var userRole UserRole
-	res = a.DB.Where("role_id = ?", role.ID).First(&userRole)
-	if res.Error == nil {
-		// role is assigned
-		return ErrRoleInUse
+	var result []uint
+	query := a.DB.Model(&UserRole{}).Where("role_id = ?", role.ID)
+	res = opts.apply(query, "", "user_id").Pluck("user_id", &result)
+
+	return result, res.Error
+}
+
+// ListRolesWithPermission returns a page of the role names granted the
+// permission
+func (a *AuthorizationX) ListRolesWithPermission(permName string, opts ListOptions) (names []string, err error) {
+	op := a.startSpan("ListRolesWithPermission", permissionAttr(permName))
+	defer op.end(&err)
+
+	// find the permission
+	var perm Permission
+	res := a.DB.Where("name = ?", permName).First(&perm)
+	if res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrPermissionNotFound
+		}
+		return nil, res.Error
 	}
 
-	// revoke the assignment of permissions before deleting the role
-	a.DB.Where("role_id = ?", role.ID).Delete(RolePermission{})
+	roles := a.DB.Statement.Quote(tableName(a.DB, Role{}))
+	rolePermissions := a.DB.Statement.Quote(tableName(a.DB, RolePermission{}))
 
-	// delete the role
-	a.DB.Where("name = ?", roleName).Delete(Role{})
+	var result []string
+	query := a.DB.Model(&Role{}).
+		Joins("JOIN "+rolePermissions+" ON "+rolePermissions+".role_id = "+roles+".id").
+		Where(rolePermissions+".permission_id = ?", perm.ID)
+	res = opts.apply(query, roles+".name", roles+".id").Pluck(roles+".name", &result)
 
-	return nil
+	return result, res.Error
 }
 
-func (a *AuthorizationX) DeletePermission(permName string) error {
+// GetUsersWithRole returns a page of the user ids the role is assigned to
+func (a *AuthorizationX) GetUsersWithRole(roleName string, opts ListOptions) (userIDs []uint, err error) {
+	op := a.startSpan("GetUsersWithRole", roleAttr(roleName))
+	defer op.end(&err)
+
+	return a.WithContext(op.ctx).ListUsersWithRole(roleName, opts)
+}
+
+// GetUsersWithPermission returns a page of the user ids granted the permission
+// through any of their roles, the name filters do not apply and name sorting
+// falls back to the user id
+func (a *AuthorizationX) GetUsersWithPermission(permName string, opts ListOptions) (userIDs []uint, err error) {
+	op := a.startSpan("GetUsersWithPermission", permissionAttr(permName))
+	defer op.end(&err)
+
 	// find the permission
 	var perm Permission
 	res := a.DB.Where("name = ?", permName).First(&perm)
 	if res.Error != nil {
 		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
-			return ErrPermissionNotFound
+			return nil, ErrPermissionNotFound
 		}
-
+		return nil, res.Error
 	}
 
-	// check if the permission is assigned to a role
-	var rolePermission RolePermission
-	res = a.DB.Where("permission_id = ?", perm.ID).First(&rolePermission)
-	if res.Error == nil {
-		// role is assigned
-		return ErrPermissionInUse
-	}
+	userRoles := a.DB.Statement.Quote(tableName(a.DB, UserRole{}))
+	rolePermissions := a.DB.Statement.Quote(tableName(a.DB, RolePermission{}))
 
-	// delete the permission
-	a.DB.Where("name = ?", permName).Delete(Permission{})
+	// users holding an active role granted the permission
+	var result []uint
+	query := a.DB.Model(&UserRole{}).
+		Joins("JOIN "+rolePermissions+" ON "+rolePermissions+".role_id = "+userRoles+".role_id").
+		Where(rolePermissions+".permission_id = ?", perm.ID).
+		Where(userRoles+".role_id IN (?)", a.DB.Model(&Role{}).Select("id"))
+	res = opts.apply(query, "", userRoles+".user_id").Distinct().Pluck(userRoles+".user_id", &result)
 
-	return nil
+	return result, res.Error
+}
+
+// countUnique returns the number of distinct names
+func countUnique(names []string) int {
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		seen[name] = true
+	}
+
+	return len(seen)
 }
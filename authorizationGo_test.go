@@ -1,14 +1,26 @@
 package AuthorizationGo_test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
-	"github.com/joho/godotenv"
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
+	"time"
+
 	AuthorizationGo "github.com/SoegiDev/AuthorizationGo"
+	"github.com/SoegiDev/AuthorizationGo/internal/testdb"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 )
 
 
@@ -18,22 +30,12 @@ var db *gorm.DB
 var prefix_test string = "authGo_"
 
 func TestMain(m *testing.M) {
-	err := godotenv.Load()
+	var err error
+	db, err = testdb.Open("authorizationGo")
 	if err != nil {
-		log.Fatal("Error loading .env file")
-	}
-	var dsn string
-	if os.Getenv("env") == "testing" {
-		fmt.Println("preparing testing config...")
-		dsn = fmt.Sprintf("host=localhost user=%s password=%s dbname=authorizationGo port=5432 sslmode=disable TimeZone=Asia/Shanghai",
-			os.Getenv("DbUser"),os.Getenv("DbPassword"))
-	} else {
-		dsn = fmt.Sprintf("host=localhost user=%s password=%s dbname=authorizationGo port=5432 sslmode=disable TimeZone=Asia/Shanghai",
-		os.Getenv("DbUser"),os.Getenv("DbPassword"))
+		log.Fatal("Error opening the test database: ", err)
 	}
 
-	db, _ = gorm.Open(postgres.Open(dsn), &gorm.Config{})
-
 	// call flag.Parse() here if TestMain uses flags
 	os.Exit(m.Run())
 }
@@ -70,7 +72,7 @@ func TestCreateRole(t *testing.T) {
 	}
 
 	// clean up
-	db.Where("name = ?", "role-a").Delete(AuthorizationGo.Role{})
+	db.Unscoped().Where("name = ?", "role-a").Delete(&AuthorizationGo.Role{})
 }
 
 func TestCreatePermission(t *testing.T) {
@@ -104,7 +106,7 @@ func TestCreatePermission(t *testing.T) {
 	}
 
 	// clean up
-	db.Where("name = ?", "permission-a").Delete(AuthorizationGo.Permission{})
+	db.Unscoped().Where("name = ?", "permission-a").Delete(&AuthorizationGo.Permission{})
 }
 
 func TestAssignPermission(t *testing.T) {
@@ -157,9 +159,9 @@ func TestAssignPermission(t *testing.T) {
 
 	// clean up
 	db.Where("role_id = ?", r.ID).Delete(AuthorizationGo.RolePermission{})
-	db.Where("name = ?", "role-a").Delete(AuthorizationGo.Role{})
-	db.Where("name = ?", "permission-a").Delete(AuthorizationGo.Permission{})
-	db.Where("name = ?", "permission-b").Delete(AuthorizationGo.Permission{})
+	db.Unscoped().Where("name = ?", "role-a").Delete(&AuthorizationGo.Role{})
+	db.Unscoped().Where("name = ?", "permission-a").Delete(&AuthorizationGo.Permission{})
+	db.Unscoped().Where("name = ?", "permission-b").Delete(&AuthorizationGo.Permission{})
 }
 
 func TestAssignRole(t *testing.T) {
@@ -209,8 +211,8 @@ func TestAssignRole(t *testing.T) {
 
 	//clean up
 	db.Where("user_id = ?", 1).Delete(AuthorizationGo.UserRole{})
-	db.Where("name = ?", "role-a").Delete(AuthorizationGo.Role{})
-	db.Where("name = ?", "role-b").Delete(AuthorizationGo.Role{})
+	db.Unscoped().Where("name = ?", "role-a").Delete(&AuthorizationGo.Role{})
+	db.Unscoped().Where("name = ?", "role-b").Delete(&AuthorizationGo.Role{})
 }
 
 func TestCheckRole(t *testing.T) {
@@ -255,7 +257,7 @@ func TestCheckRole(t *testing.T) {
 	var r AuthorizationGo.Role
 	db.Where("name = ?", "role-a").First(&r)
 	db.Where("role_id = ?", r.ID).Delete(AuthorizationGo.UserRole{})
-	db.Where("name = ?", "role-a").Delete(AuthorizationGo.Role{})
+	db.Unscoped().Where("name = ?", "role-a").Delete(&AuthorizationGo.Role{})
 }
 
 func TestCheckPermission(t *testing.T) {
@@ -334,10 +336,10 @@ func TestCheckPermission(t *testing.T) {
 	db.Where("name = ?", "role-a").First(&r)
 	db.Where("role_id = ?", r.ID).Delete(AuthorizationGo.UserRole{})
 	db.Where("role_id = ?", r.ID).Delete(AuthorizationGo.RolePermission{})
-	db.Where("name = ?", "permission-a").Delete(AuthorizationGo.Permission{})
-	db.Where("name = ?", "permission-b").Delete(AuthorizationGo.Permission{})
-	db.Where("name = ?", "permission-c").Delete(AuthorizationGo.Permission{})
-	db.Where("name = ?", "role-a").Delete(AuthorizationGo.Role{})
+	db.Unscoped().Where("name = ?", "permission-a").Delete(&AuthorizationGo.Permission{})
+	db.Unscoped().Where("name = ?", "permission-b").Delete(&AuthorizationGo.Permission{})
+	db.Unscoped().Where("name = ?", "permission-c").Delete(&AuthorizationGo.Permission{})
+	db.Unscoped().Where("name = ?", "role-a").Delete(&AuthorizationGo.Role{})
 }
 
 func TestCheckRolePermission(t *testing.T) {
@@ -400,10 +402,10 @@ func TestCheckRolePermission(t *testing.T) {
 	var r AuthorizationGo.Role
 	db.Where("name = ?", "role-a").First(&r)
 	db.Where("role_id = ?", r.ID).Delete(AuthorizationGo.RolePermission{})
-	db.Where("name = ?", "permission-a").Delete(AuthorizationGo.Permission{})
-	db.Where("name = ?", "permission-b").Delete(AuthorizationGo.Permission{})
-	db.Where("name = ?", "permission-c").Delete(AuthorizationGo.Permission{})
-	db.Where("name = ?", "role-a").Delete(AuthorizationGo.Role{})
+	db.Unscoped().Where("name = ?", "permission-a").Delete(&AuthorizationGo.Permission{})
+	db.Unscoped().Where("name = ?", "permission-b").Delete(&AuthorizationGo.Permission{})
+	db.Unscoped().Where("name = ?", "permission-c").Delete(&AuthorizationGo.Permission{})
+	db.Unscoped().Where("name = ?", "role-a").Delete(&AuthorizationGo.Role{})
 }
 
 func TestRevokeRole(t *testing.T) {
@@ -444,7 +446,7 @@ func TestRevokeRole(t *testing.T) {
 	var r AuthorizationGo.Role
 	db.Where("name = ?", "role-a").First(&r)
 	db.Where("role_id = ?", r.ID).Delete(AuthorizationGo.UserRole{})
-	db.Where("name = ?", "role-a").Delete(AuthorizationGo.Role{})
+	db.Unscoped().Where("name = ?", "role-a").Delete(&AuthorizationGo.Role{})
 }
 
 func TestRevokePermission(t *testing.T) {
@@ -510,9 +512,9 @@ func TestRevokePermission(t *testing.T) {
 	// clean up
 	db.Where("role_id = ?", r.ID).Delete(AuthorizationGo.UserRole{})
 	db.Where("role_id = ?", r.ID).Delete(AuthorizationGo.RolePermission{})
-	db.Where("name = ?", "permission-a").Delete(AuthorizationGo.Permission{})
-	db.Where("name = ?", "permission-b").Delete(AuthorizationGo.Permission{})
-	db.Where("name = ?", "role-a").Delete(AuthorizationGo.Role{})
+	db.Unscoped().Where("name = ?", "permission-a").Delete(&AuthorizationGo.Permission{})
+	db.Unscoped().Where("name = ?", "permission-b").Delete(&AuthorizationGo.Permission{})
+	db.Unscoped().Where("name = ?", "role-a").Delete(&AuthorizationGo.Role{})
 }
 
 func TestRevokeRolePermission(t *testing.T) {
@@ -569,9 +571,9 @@ func TestRevokeRolePermission(t *testing.T) {
 
 	// clean up
 	db.Where("role_id = ?", r.ID).Delete(AuthorizationGo.RolePermission{})
-	db.Where("name = ?", "permission-a").Delete(AuthorizationGo.Permission{})
-	db.Where("name = ?", "permission-b").Delete(AuthorizationGo.Permission{})
-	db.Where("name = ?", "role-a").Delete(AuthorizationGo.Role{})
+	db.Unscoped().Where("name = ?", "permission-a").Delete(&AuthorizationGo.Permission{})
+	db.Unscoped().Where("name = ?", "permission-b").Delete(&AuthorizationGo.Permission{})
+	db.Unscoped().Where("name = ?", "role-a").Delete(&AuthorizationGo.Role{})
 }
 
 func TestGetRoles(t *testing.T) {
@@ -596,8 +598,8 @@ func TestGetRoles(t *testing.T) {
 	if len(roles) != 2 {
 		t.Error("failed assert getting roles")
 	}
-	db.Where("name = ?", "role-a").Delete(AuthorizationGo.Role{})
-	db.Where("name = ?", "role-b").Delete(AuthorizationGo.Role{})
+	db.Unscoped().Where("name = ?", "role-a").Delete(&AuthorizationGo.Role{})
+	db.Unscoped().Where("name = ?", "role-b").Delete(&AuthorizationGo.Role{})
 }
 
 func TestGetPermissions(t *testing.T) {
@@ -622,8 +624,8 @@ func TestGetPermissions(t *testing.T) {
 	if len(perms) != 2 {
 		t.Error("failed assert getting permission")
 	}
-	db.Where("name = ?", "permission-a").Delete(AuthorizationGo.Permission{})
-	db.Where("name = ?", "permission-b").Delete(AuthorizationGo.Permission{})
+	db.Unscoped().Where("name = ?", "permission-a").Delete(&AuthorizationGo.Permission{})
+	db.Unscoped().Where("name = ?", "permission-b").Delete(&AuthorizationGo.Permission{})
 }
 
 func TestDeleteRole(t *testing.T) {
@@ -733,8 +735,8 @@ func TestGetUserRoles(t *testing.T) {
 	}
 
 	db.Where("user_id = ?", 1).Delete(AuthorizationGo.UserRole{})
-	db.Where("name = ?", "role-a").Delete(AuthorizationGo.Role{})
-	db.Where("name = ?", "role-b").Delete(AuthorizationGo.Role{})
+	db.Unscoped().Where("name = ?", "role-a").Delete(&AuthorizationGo.Role{})
+	db.Unscoped().Where("name = ?", "role-b").Delete(&AuthorizationGo.Role{})
 }
 
 func sliceHasString(s []string, val string) bool {
@@ -745,4 +747,1912 @@ func sliceHasString(s []string, val string) bool {
 	}
 
 	return false
-}
\ No newline at end of file
+}
+
+func TestRenameRole(t *testing.T) {
+	auth := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: prefix_test,
+		DB:           db,
+	})
+
+	auth.CreateRole("role-a")
+	auth.CreateRole("role-b")
+	auth.CreatePermission("permission-a")
+	auth.AssignPermissions("role-a", []string{"permission-a"})
+	auth.AssignRole(1, "role-a")
+
+	// rename a missing role
+	err := auth.RenameRole("role-aa", "role-c")
+	if err != AuthorizationGo.ErrRoleNotFound {
+		t.Error("expecting ErrRoleNotFound when renaming a missing role")
+	}
+
+	// rename to a taken name
+	err = auth.RenameRole("role-a", "role-b")
+	if err != AuthorizationGo.ErrRoleAlreadyExists {
+		t.Error("expecting ErrRoleAlreadyExists when renaming to an existing role")
+	}
+
+	err = auth.RenameRole("role-a", "role-c")
+	if err != nil {
+		t.Error("unexpected error while renaming role.", err)
+	}
+
+	// the active names are unique even when the check is bypassed
+	if err := db.Create(&AuthorizationGo.Role{Name: "role-b"}).Error; err == nil {
+		t.Error("expecting the unique index to refuse a duplicated active name")
+	}
+	auth.DeleteRole("role-b")
+	if err := auth.CreateRole("role-b"); err != nil {
+		t.Error("expecting a deleted name to be reusable", err)
+	}
+
+	// assignments are kept
+	ok, _ := auth.CheckRole(1, "role-c")
+	if !ok {
+		t.Error("expecting the renamed role to stay assigned")
+	}
+	ok, _ = auth.CheckRolePermission("role-c", "permission-a")
+	if !ok {
+		t.Error("expecting the renamed role to keep its permissions")
+	}
+	_, err = auth.CheckRole(1, "role-a")
+	if err == nil {
+		t.Error("expecting an error when checking the old role name")
+	}
+
+	// clean up
+	var r AuthorizationGo.Role
+	db.Where("name = ?", "role-c").First(&r)
+	db.Where("role_id = ?", r.ID).Delete(AuthorizationGo.UserRole{})
+	db.Where("role_id = ?", r.ID).Delete(AuthorizationGo.RolePermission{})
+	db.Unscoped().Where("name = ?", "permission-a").Delete(&AuthorizationGo.Permission{})
+	db.Unscoped().Where("name = ?", "role-b").Delete(&AuthorizationGo.Role{})
+	db.Unscoped().Where("name = ?", "role-c").Delete(&AuthorizationGo.Role{})
+}
+
+func TestRenamePermission(t *testing.T) {
+	auth := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: prefix_test,
+		DB:           db,
+	})
+
+	auth.CreateRole("role-a")
+	auth.CreatePermission("permission-a")
+	auth.CreatePermission("permission-b")
+	auth.AssignPermissions("role-a", []string{"permission-a"})
+
+	// rename a missing permission
+	err := auth.RenamePermission("permission-aa", "permission-c")
+	if err != AuthorizationGo.ErrPermissionNotFound {
+		t.Error("expecting ErrPermissionNotFound when renaming a missing permission")
+	}
+
+	// rename to a taken name
+	err = auth.RenamePermission("permission-a", "permission-b")
+	if err != AuthorizationGo.ErrPermissionAlreadyExists {
+		t.Error("expecting ErrPermissionAlreadyExists when renaming to an existing permission")
+	}
+
+	err = auth.RenamePermission("permission-a", "permission-c")
+	if err != nil {
+		t.Error("unexpected error while renaming permission.", err)
+	}
+
+	// grants are kept
+	ok, _ := auth.CheckRolePermission("role-a", "permission-c")
+	if !ok {
+		t.Error("expecting the renamed permission to stay granted")
+	}
+
+	// clean up
+	var r AuthorizationGo.Role
+	db.Where("name = ?", "role-a").First(&r)
+	db.Where("role_id = ?", r.ID).Delete(AuthorizationGo.RolePermission{})
+	db.Unscoped().Where("name = ?", "permission-b").Delete(&AuthorizationGo.Permission{})
+	db.Unscoped().Where("name = ?", "permission-c").Delete(&AuthorizationGo.Permission{})
+	db.Unscoped().Where("name = ?", "role-a").Delete(&AuthorizationGo.Role{})
+}
+
+func TestDeleteRoleWithOptions(t *testing.T) {
+	auth := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: prefix_test,
+		DB:           db,
+	})
+
+	auth.CreateRole("role-a")
+	auth.CreateRole("role-b")
+	auth.CreatePermission("permission-a")
+	auth.AssignPermissions("role-a", []string{"permission-a"})
+	auth.AssignRole(1, "role-a")
+	auth.AssignRole(2, "role-a")
+	auth.AssignRole(2, "role-b")
+
+	// reassign to a missing role
+	err := auth.DeleteRole("role-a", AuthorizationGo.WithReassignTo("role-bb"))
+	if err != AuthorizationGo.ErrRoleNotFound {
+		t.Error("expecting ErrRoleNotFound when reassigning to a missing role")
+	}
+
+	// reassign to the deleted role
+	err = auth.DeleteRole("role-a", AuthorizationGo.WithReassignTo("role-a"))
+	if err != AuthorizationGo.ErrReassignToSelf {
+		t.Error("expecting ErrReassignToSelf when reassigning to the deleted role")
+	}
+
+	// reassign the users to role-b
+	n, err := auth.DeleteRoleCount("role-a", AuthorizationGo.WithReassignTo("role-b"))
+	if err != nil {
+		t.Error("unexpected error while deleting role.", err)
+	}
+	// two user assignments, the permission grant is kept by the soft delete
+	if n != 2 {
+		t.Error("expecting 2 affected assignments, got", n)
+	}
+	roles, _ := auth.GetUserRoles(1)
+	if len(roles) != 1 || roles[0] != "role-b" {
+		t.Error("expecting user 1 to be reassigned to role-b")
+	}
+	roles, _ = auth.GetUserRoles(2)
+	if len(roles) != 1 || roles[0] != "role-b" {
+		t.Error("expecting user 2 to hold role-b only once")
+	}
+
+	// cascade the assignments
+	n, err = auth.DeleteRoleCount("role-b", AuthorizationGo.WithCascade())
+	if err != nil {
+		t.Error("unexpected error while deleting role.", err)
+	}
+	if n != 2 {
+		t.Error("expecting 2 affected assignments, got", n)
+	}
+
+	var c int64
+	db.Model(AuthorizationGo.UserRole{}).Count(&c)
+	if c != 0 {
+		t.Error("failed assert cascading role assignments")
+	}
+
+	// clean up
+	var r AuthorizationGo.Role
+	db.Unscoped().Where("name = ?", "role-a").First(&r)
+	db.Where("role_id = ?", r.ID).Delete(AuthorizationGo.RolePermission{})
+	db.Unscoped().Where("name = ?", "role-a").Delete(&AuthorizationGo.Role{})
+	db.Unscoped().Where("name = ?", "permission-a").Delete(&AuthorizationGo.Permission{})
+}
+
+func TestDeletePermissionWithOptions(t *testing.T) {
+	auth := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: prefix_test,
+		DB:           db,
+	})
+
+	auth.CreateRole("role-a")
+	auth.CreateRole("role-b")
+	auth.CreatePermission("permission-a")
+	auth.CreatePermission("permission-b")
+	auth.AssignPermissions("role-a", []string{"permission-a"})
+	auth.AssignPermissions("role-b", []string{"permission-a", "permission-b"})
+
+	// reassign to a missing permission
+	err := auth.DeletePermission("permission-a", AuthorizationGo.WithReassignTo("permission-bb"))
+	if err != AuthorizationGo.ErrPermissionNotFound {
+		t.Error("expecting ErrPermissionNotFound when reassigning to a missing permission")
+	}
+
+	// reassign the grants to permission-b
+	n, err := auth.DeletePermissionCount("permission-a", AuthorizationGo.WithReassignTo("permission-b"))
+	if err != nil {
+		t.Error("unexpected error while deleting permission.", err)
+	}
+	if n != 2 {
+		t.Error("expecting 2 affected grants, got", n)
+	}
+	ok, _ := auth.CheckRolePermission("role-a", "permission-b")
+	if !ok {
+		t.Error("expecting role-a to be granted permission-b")
+	}
+
+	// cascade the grants
+	n, err = auth.DeletePermissionCount("permission-b", AuthorizationGo.WithCascade())
+	if err != nil {
+		t.Error("unexpected error while deleting permission.", err)
+	}
+	if n != 2 {
+		t.Error("expecting 2 affected grants, got", n)
+	}
+
+	var roleIDs []uint
+	db.Model(AuthorizationGo.Role{}).Where("name IN (?)", []string{"role-a", "role-b"}).Pluck("id", &roleIDs)
+	var c int64
+	db.Model(AuthorizationGo.RolePermission{}).Where("role_id IN (?)", roleIDs).Count(&c)
+	if c != 0 {
+		t.Error("failed assert cascading permission grants")
+	}
+
+	// clean up
+	db.Unscoped().Where("name = ?", "role-a").Delete(&AuthorizationGo.Role{})
+	db.Unscoped().Where("name = ?", "role-b").Delete(&AuthorizationGo.Role{})
+}
+
+func TestRestoreRole(t *testing.T) {
+	auth := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: prefix_test,
+		DB:           db,
+	})
+
+	auth.CreateRole("role-a")
+	auth.CreatePermission("permission-a")
+	auth.AssignPermissions("role-a", []string{"permission-a"})
+	auth.AssignRole(1, "role-a")
+
+	// restore a role which is not deleted
+	err := auth.RestoreRole("role-a")
+	if err != AuthorizationGo.ErrRoleAlreadyExists {
+		t.Error("expecting ErrRoleAlreadyExists when restoring an active role")
+	}
+
+	// force delete the assigned role
+	err = auth.DeleteRole("role-a", AuthorizationGo.WithForce())
+	if err != nil {
+		t.Error("unexpected error while deleting role.", err)
+	}
+
+	// the deleted role does not grant access anymore
+	ok, _ := auth.CheckPermission(1, "permission-a")
+	if ok {
+		t.Error("expecting false when checking permission of a deleted role")
+	}
+	roles, _ := auth.GetUserRoles(1)
+	if len(roles) != 0 {
+		t.Error("expecting deleted role not to be returned")
+	}
+
+	err = auth.RestoreRole("role-a")
+	if err != nil {
+		t.Error("unexpected error while restoring role.", err)
+	}
+
+	// assignments and permissions are back
+	ok, _ = auth.CheckPermission(1, "permission-a")
+	if !ok {
+		t.Error("expecting the restored role to grant its permissions")
+	}
+
+	// restore a role when the name is taken
+	auth.DeleteRole("role-a", AuthorizationGo.WithForce())
+	auth.CreateRole("role-a")
+	err = auth.RestoreRole("role-a")
+	if err != AuthorizationGo.ErrRoleAlreadyExists {
+		t.Error("expecting ErrRoleAlreadyExists when restoring a taken name")
+	}
+
+	// purged roles cannot be restored
+	auth.DeleteRole("role-a", AuthorizationGo.WithPurge())
+	err = auth.RestoreRole("role-a")
+	if err != nil {
+		t.Error("unexpected error while restoring role.", err)
+	}
+	n, err := auth.DeleteRoleCount("role-a", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+	if err != nil {
+		t.Error("unexpected error while purging role.", err)
+	}
+	// the grant of the purged role is not counted
+	if n != 1 {
+		t.Error("expecting 1 affected assignment, got", n)
+	}
+	err = auth.RestoreRole("role-a")
+	if err != AuthorizationGo.ErrRoleNotFound {
+		t.Error("expecting ErrRoleNotFound when restoring a purged role")
+	}
+
+	// clean up
+	db.Unscoped().Where("name = ?", "permission-a").Delete(&AuthorizationGo.Permission{})
+}
+
+func TestRestorePermission(t *testing.T) {
+	auth := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: prefix_test,
+		DB:           db,
+	})
+
+	auth.CreateRole("role-a")
+	auth.CreatePermission("permission-a")
+	auth.AssignPermissions("role-a", []string{"permission-a"})
+
+	// force delete the granted permission
+	err := auth.DeletePermission("permission-a", AuthorizationGo.WithForce())
+	if err != nil {
+		t.Error("unexpected error while deleting permission.", err)
+	}
+
+	_, err = auth.CheckRolePermission("role-a", "permission-a")
+	if err != AuthorizationGo.ErrPermissionNotFound {
+		t.Error("expecting ErrPermissionNotFound when checking a deleted permission")
+	}
+
+	err = auth.RestorePermission("permission-a")
+	if err != nil {
+		t.Error("unexpected error while restoring permission.", err)
+	}
+
+	ok, _ := auth.CheckRolePermission("role-a", "permission-a")
+	if !ok {
+		t.Error("expecting the restored permission to be granted")
+	}
+
+	// restore a missing permission
+	err = auth.RestorePermission("permission-aa")
+	if err != AuthorizationGo.ErrPermissionNotFound {
+		t.Error("expecting ErrPermissionNotFound when restoring a missing permission")
+	}
+
+	// clean up
+	auth.DeletePermission("permission-a", AuthorizationGo.WithCascade(), AuthorizationGo.WithPurge())
+	auth.DeleteRole("role-a", AuthorizationGo.WithPurge())
+}
+
+func TestListRoles(t *testing.T) {
+	auth := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: prefix_test,
+		DB:           db,
+	})
+
+	auth.CreateRole("role-a")
+	auth.CreateRole("role-b")
+	auth.CreateRole("role-c")
+	auth.CreateRole("admin_a")
+	auth.CreateRole("adminxa")
+
+	// paginate
+	roles, err := auth.ListRoles(AuthorizationGo.ListOptions{Limit: 2, Offset: 1, Prefix: "role-"})
+	if err != nil {
+		t.Error("unexpected error while listing roles.", err)
+	}
+	if len(roles) != 2 || roles[0] != "role-b" || roles[1] != "role-c" {
+		t.Error("failed assert paginating roles", roles)
+	}
+
+	// sort
+	roles, _ = auth.ListRoles(AuthorizationGo.ListOptions{Prefix: "role-", Sort: AuthorizationGo.SortByNameDesc})
+	if len(roles) != 3 || roles[0] != "role-c" {
+		t.Error("failed assert sorting roles", roles)
+	}
+
+	// wildcards in the filters are escaped
+	roles, _ = auth.ListRoles(AuthorizationGo.ListOptions{Prefix: "admin_"})
+	if len(roles) != 1 || roles[0] != "admin_a" {
+		t.Error("failed assert filtering roles by prefix", roles)
+	}
+	roles, _ = auth.ListRoles(AuthorizationGo.ListOptions{Contains: "-b"})
+	if len(roles) != 1 || roles[0] != "role-b" {
+		t.Error("failed assert filtering roles by substring", roles)
+	}
+
+	// the filters ignore case on every backend
+	roles, _ = auth.ListRoles(AuthorizationGo.ListOptions{Prefix: "ROLE-", Contains: "-B"})
+	if len(roles) != 1 || roles[0] != "role-b" {
+		t.Error("failed assert filtering roles ignoring case", roles)
+	}
+
+	// user roles
+	auth.AssignRole(1, "role-a")
+	auth.AssignRole(1, "role-c")
+	roles, _ = auth.ListUserRoles(1, AuthorizationGo.ListOptions{Sort: AuthorizationGo.SortByNameDesc})
+	if len(roles) != 2 || roles[0] != "role-c" || roles[1] != "role-a" {
+		t.Error("failed assert listing user roles", roles)
+	}
+
+	// clean up
+	db.Where("user_id = ?", 1).Delete(AuthorizationGo.UserRole{})
+	db.Unscoped().Where("name IN (?)", []string{"role-a", "role-b", "role-c", "admin_a", "adminxa"}).Delete(&AuthorizationGo.Role{})
+}
+
+func TestTablesPrefixChange(t *testing.T) {
+	auth := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: prefix_test,
+		DB:           db,
+	})
+	auth.CreateRole("role-a")
+	auth.CreatePermission("permission-a")
+	auth.AssignPermissions("role-a", []string{"permission-a"})
+	auth.AssignRole(1, "role-a")
+
+	// gorm keeps the tables of the first prefix, the queries written by hand
+	// must use them too
+	auth = AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: "authGo_other_",
+		DB:           db,
+	})
+	defer AuthorizationGo.New(AuthorizationGo.AuthOption{TablesPrefix: prefix_test, DB: db})
+
+	ok, err := auth.CheckPermission(1, "permission-a")
+	if err != nil || !ok {
+		t.Error("expecting the permission check to use the parsed tables.", err)
+	}
+	roles, err := auth.ListUserRoles(1, AuthorizationGo.ListOptions{})
+	if err != nil || len(roles) != 1 {
+		t.Error("expecting the user roles to be listed from the parsed tables.", roles, err)
+	}
+	policy, err := auth.ExportPolicy()
+	if err != nil || len(policy.Users) != 1 {
+		t.Error("expecting the policy to be exported from the parsed tables.", err)
+	}
+
+	// clean up
+	db.Where("user_id = ?", 1).Delete(AuthorizationGo.UserRole{})
+	auth.DeleteRole("role-a", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+	auth.DeletePermission("permission-a", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+}
+
+// errorLogger records the errors logged by gorm
+type errorLogger struct {
+	logger.Interface
+	errors []string
+}
+
+func (l *errorLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	l.errors = append(l.errors, fmt.Sprintf(msg, args...))
+}
+
+func TestMigrateDuplicateNames(t *testing.T) {
+	auth := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: prefix_test,
+		DB:           db,
+	})
+
+	// the tables of an older version may have duplicate active names
+	table := prefix_test + "roles"
+	if err := db.Migrator().DropIndex(table, table+"_active_name"); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&AuthorizationGo.Role{Name: "role-dup"})
+	db.Create(&AuthorizationGo.Role{Name: "role-dup"})
+
+	logged := &errorLogger{Interface: db.Logger}
+	AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: prefix_test,
+		DB:           db.Session(&gorm.Session{Logger: logged}),
+	})
+	if len(logged.errors) != 1 || !strings.Contains(logged.errors[0], "duplicate names") {
+		t.Error("expecting New to log the migration error", logged.errors)
+	}
+	if err := auth.Migrate(); err == nil {
+		t.Error("expecting Migrate to fail on the duplicate names")
+	}
+
+	// the index is created once the duplicates are removed
+	var dup AuthorizationGo.Role
+	db.Where("name = ?", "role-dup").First(&dup)
+	db.Unscoped().Delete(&dup)
+	if err := auth.Migrate(); err != nil {
+		t.Error("unexpected error while migrating.", err)
+	}
+	if err := db.Create(&AuthorizationGo.Role{Name: "role-dup"}).Error; err == nil {
+		t.Error("expecting the index to refuse the duplicate names")
+	}
+
+	// clean up
+	db.Unscoped().Where("name = ?", "role-dup").Delete(&AuthorizationGo.Role{})
+}
+
+func TestListUsersWithRole(t *testing.T) {
+	auth := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: prefix_test,
+		DB:           db,
+	})
+
+	auth.CreateRole("role-a")
+	auth.AssignRole(3, "role-a")
+	auth.AssignRole(1, "role-a")
+	auth.AssignRole(2, "role-a")
+
+	users, err := auth.ListUsersWithRole("role-a", AuthorizationGo.ListOptions{Limit: 2})
+	if err != nil {
+		t.Error("unexpected error while listing users.", err)
+	}
+	if len(users) != 2 || users[0] != 1 || users[1] != 2 {
+		t.Error("failed assert listing users with role", users)
+	}
+
+	users, _ = auth.ListUsersWithRole("role-a", AuthorizationGo.ListOptions{Sort: AuthorizationGo.SortByIDDesc})
+	if len(users) != 3 || users[0] != 3 {
+		t.Error("failed assert sorting users with role", users)
+	}
+
+	// missing role
+	_, err = auth.ListUsersWithRole("role-aa", AuthorizationGo.ListOptions{})
+	if err != AuthorizationGo.ErrRoleNotFound {
+		t.Error("expecting ErrRoleNotFound when listing users of a missing role")
+	}
+
+	// clean up
+	var r AuthorizationGo.Role
+	db.Where("name = ?", "role-a").First(&r)
+	db.Where("role_id = ?", r.ID).Delete(AuthorizationGo.UserRole{})
+	db.Unscoped().Where("name = ?", "role-a").Delete(&AuthorizationGo.Role{})
+}
+
+func TestListRolesWithPermission(t *testing.T) {
+	auth := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: prefix_test,
+		DB:           db,
+	})
+
+	auth.CreateRole("role-a")
+	auth.CreateRole("role-b")
+	auth.CreateRole("role-c")
+	auth.CreatePermission("permission-a")
+	auth.AssignPermissions("role-a", []string{"permission-a"})
+	auth.AssignPermissions("role-c", []string{"permission-a"})
+
+	roles, err := auth.ListRolesWithPermission("permission-a", AuthorizationGo.ListOptions{})
+	if err != nil {
+		t.Error("unexpected error while listing roles.", err)
+	}
+	if len(roles) != 2 || roles[0] != "role-a" || roles[1] != "role-c" {
+		t.Error("failed assert listing roles with permission", roles)
+	}
+
+	// missing permission
+	_, err = auth.ListRolesWithPermission("permission-aa", AuthorizationGo.ListOptions{})
+	if err != AuthorizationGo.ErrPermissionNotFound {
+		t.Error("expecting ErrPermissionNotFound when listing roles of a missing permission")
+	}
+
+	// clean up
+	auth.DeletePermission("permission-a", AuthorizationGo.WithCascade(), AuthorizationGo.WithPurge())
+	db.Unscoped().Where("name IN (?)", []string{"role-a", "role-b", "role-c"}).Delete(&AuthorizationGo.Role{})
+}
+
+func TestGetUsersWithPermission(t *testing.T) {
+	auth := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: prefix_test,
+		DB:           db,
+	})
+
+	auth.CreateRole("role-a")
+	auth.CreateRole("role-b")
+	auth.CreateRole("role-c")
+	auth.CreatePermission("permission-a")
+	auth.AssignPermissions("role-a", []string{"permission-a"})
+	auth.AssignPermissions("role-b", []string{"permission-a"})
+	auth.AssignPermissions("role-c", []string{"permission-a"})
+	auth.AssignRole(1, "role-a")
+	auth.AssignRole(1, "role-b")
+	auth.AssignRole(2, "role-b")
+	auth.AssignRole(3, "role-c")
+
+	// users holding the permission through several roles are returned once
+	users, err := auth.GetUsersWithPermission("permission-a", AuthorizationGo.ListOptions{})
+	if err != nil {
+		t.Error("unexpected error while getting users.", err)
+	}
+	if len(users) != 3 {
+		t.Error("failed assert getting users with permission", users)
+	}
+
+	// deleted roles do not grant the permission
+	auth.DeleteRole("role-c", AuthorizationGo.WithForce())
+	users, _ = auth.GetUsersWithPermission("permission-a", AuthorizationGo.ListOptions{Limit: 1, Offset: 1})
+	if len(users) != 1 || users[0] != 2 {
+		t.Error("failed assert paginating users with permission", users)
+	}
+
+	users, _ = auth.GetUsersWithRole("role-b", AuthorizationGo.ListOptions{})
+	if len(users) != 2 {
+		t.Error("failed assert getting users with role", users)
+	}
+
+	// missing permission
+	_, err = auth.GetUsersWithPermission("permission-aa", AuthorizationGo.ListOptions{})
+	if err != AuthorizationGo.ErrPermissionNotFound {
+		t.Error("expecting ErrPermissionNotFound when getting users of a missing permission")
+	}
+
+	// clean up
+	auth.RestoreRole("role-c")
+	auth.DeleteRole("role-a", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+	auth.DeleteRole("role-b", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+	auth.DeleteRole("role-c", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+	auth.DeletePermission("permission-a", AuthorizationGo.WithPurge())
+}
+
+func TestExportImportPolicy(t *testing.T) {
+	auth := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: prefix_test,
+		DB:           db,
+	})
+
+	policy := &AuthorizationGo.Policy{
+		Permissions: []string{"permission-c"},
+		Roles: []AuthorizationGo.RolePolicy{
+			{Name: "role-a", Permissions: []string{"permission-a", "permission-b"}},
+			{Name: "role-b", Permissions: []string{"permission-b"}},
+		},
+		Users: []AuthorizationGo.UserPolicy{
+			{ID: 1, Roles: []string{"role-a", "role-b"}},
+			{ID: 2, Roles: []string{"role-b"}},
+		},
+	}
+
+	// importing twice keeps the existing entries
+	err := auth.ImportPolicy(policy)
+	if err != nil {
+		t.Error("unexpected error while importing policy.", err)
+	}
+	err = auth.ImportPolicy(policy)
+	if err != nil {
+		t.Error("unexpected error while importing policy again.", err)
+	}
+
+	ok, _ := auth.CheckPermission(2, "permission-b")
+	if !ok {
+		t.Error("expecting imported assignments to grant permissions")
+	}
+
+	exported, err := auth.ExportPolicy()
+	if err != nil {
+		t.Error("unexpected error while exporting policy.", err)
+	}
+	if len(exported.Permissions) != 3 || len(exported.Roles) != 2 || len(exported.Users) != 2 {
+		t.Error("failed assert exporting policy", exported)
+	}
+	if len(exported.Roles[0].Permissions) != 2 || exported.Roles[0].Permissions[1] != "permission-b" {
+		t.Error("failed assert exporting role permissions", exported.Roles[0])
+	}
+	if len(exported.Users[0].Roles) != 2 || exported.Users[1].Roles[0] != "role-b" {
+		t.Error("failed assert exporting user roles", exported.Users)
+	}
+
+	// a failing import does not leave partial changes
+	err = auth.ImportPolicy(&AuthorizationGo.Policy{
+		Roles: []AuthorizationGo.RolePolicy{{Name: "role-c"}},
+		Users: []AuthorizationGo.UserPolicy{{ID: 3, Roles: []string{"role-aa"}}},
+	})
+	if err != AuthorizationGo.ErrRoleNotFound {
+		t.Error("expecting ErrRoleNotFound when importing a missing role assignment")
+	}
+	_, err = auth.CheckRole(3, "role-c")
+	if err != AuthorizationGo.ErrRoleNotFound {
+		t.Error("expecting the failed import to be rolled back")
+	}
+
+	// clean up
+	auth.DeleteRole("role-a", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+	auth.DeleteRole("role-b", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+	db.Unscoped().Where("name IN (?)", []string{"permission-a", "permission-b", "permission-c"}).Delete(&AuthorizationGo.Permission{})
+}
+
+func TestAssignPermissionsIgnoresAssigned(t *testing.T) {
+	auth := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: prefix_test,
+		DB:           db,
+	})
+
+	auth.CreateRole("role-a")
+	auth.CreatePermission("permission-a")
+	auth.CreatePermission("permission-b")
+
+	// duplicated and already assigned permissions are inserted once
+	err := auth.AssignPermissions("role-a", []string{"permission-a"})
+	if err != nil {
+		t.Error("unexpected error while assigning permissions.", err)
+	}
+	err = auth.AssignPermissions("role-a", []string{"permission-a", "permission-b", "permission-b"})
+	if err != nil {
+		t.Error("unexpected error while assigning permissions.", err)
+	}
+
+	// a missing permission fails the whole assignment
+	err = auth.AssignPermissions("role-a", []string{"permission-a", "permission-aa"})
+	if err != AuthorizationGo.ErrPermissionNotFound {
+		t.Error("expecting ErrPermissionNotFound when assigning a missing permission")
+	}
+
+	var r AuthorizationGo.Role
+	db.Where("name = ?", "role-a").First(&r)
+	var c int64
+	db.Model(AuthorizationGo.RolePermission{}).Where("role_id = ?", r.ID).Count(&c)
+	if c != 2 {
+		t.Error("expecting 2 assigned permissions, got", c)
+	}
+
+	// clean up
+	db.Where("role_id = ?", r.ID).Delete(AuthorizationGo.RolePermission{})
+	db.Unscoped().Where("name = ?", "role-a").Delete(&AuthorizationGo.Role{})
+	db.Unscoped().Where("name IN (?)", []string{"permission-a", "permission-b"}).Delete(&AuthorizationGo.Permission{})
+}
+
+func TestAssignRoles(t *testing.T) {
+	auth := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: prefix_test,
+		DB:           db,
+	})
+
+	auth.CreateRole("role-a")
+	auth.CreateRole("role-b")
+	auth.AssignRole(1, "role-a")
+
+	// already assigned roles are ignored
+	err := auth.AssignRoles(1, []string{"role-a", "role-b"})
+	if err != nil {
+		t.Error("unexpected error while assigning roles.", err)
+	}
+	roles, _ := auth.GetUserRoles(1)
+	if len(roles) != 2 {
+		t.Error("expecting two roles to be assigned", roles)
+	}
+
+	// a missing role fails the whole assignment
+	err = auth.AssignRoles(2, []string{"role-a", "role-aa"})
+	if err != AuthorizationGo.ErrRoleNotFound {
+		t.Error("expecting ErrRoleNotFound when assigning a missing role")
+	}
+	roles, _ = auth.GetUserRoles(2)
+	if len(roles) != 0 {
+		t.Error("expecting the failed assignment to be rolled back", roles)
+	}
+
+	err = auth.AssignRoleToUsers("role-b", []uint{1, 2, 3, 3})
+	if err != nil {
+		t.Error("unexpected error while assigning role to users.", err)
+	}
+	users, _ := auth.GetUsersWithRole("role-b", AuthorizationGo.ListOptions{})
+	if len(users) != 3 {
+		t.Error("expecting role-b to be assigned to 3 users", users)
+	}
+
+	err = auth.RevokeRoles(1, []string{"role-a", "role-b"})
+	if err != nil {
+		t.Error("unexpected error while revoking roles.", err)
+	}
+	roles, _ = auth.GetUserRoles(1)
+	if len(roles) != 0 {
+		t.Error("expecting the roles to be revoked", roles)
+	}
+
+	// clean up
+	db.Where("user_id IN (?)", []uint{1, 2, 3}).Delete(AuthorizationGo.UserRole{})
+	db.Unscoped().Where("name IN (?)", []string{"role-a", "role-b"}).Delete(&AuthorizationGo.Role{})
+}
+
+func TestSetUserRoles(t *testing.T) {
+	auth := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: prefix_test,
+		DB:           db,
+	})
+
+	auth.CreateRole("role-a")
+	auth.CreateRole("role-b")
+	auth.CreateRole("role-c")
+	auth.AssignRoles(1, []string{"role-a", "role-b"})
+
+	err := auth.SetUserRoles(1, []string{"role-b", "role-c"})
+	if err != nil {
+		t.Error("unexpected error while setting user roles.", err)
+	}
+	roles, _ := auth.GetUserRoles(1)
+	if len(roles) != 2 || roles[0] != "role-b" || roles[1] != "role-c" {
+		t.Error("failed assert replacing user roles", roles)
+	}
+
+	// a missing role keeps the current roles
+	err = auth.SetUserRoles(1, []string{"role-aa"})
+	if err != AuthorizationGo.ErrRoleNotFound {
+		t.Error("expecting ErrRoleNotFound when setting a missing role")
+	}
+
+	// an empty list revokes every role
+	err = auth.SetUserRoles(1, nil)
+	if err != nil {
+		t.Error("unexpected error while setting user roles.", err)
+	}
+	roles, _ = auth.GetUserRoles(1)
+	if len(roles) != 0 {
+		t.Error("expecting all the roles to be revoked", roles)
+	}
+
+	// clean up
+	db.Unscoped().Where("name IN (?)", []string{"role-a", "role-b", "role-c"}).Delete(&AuthorizationGo.Role{})
+}
+
+func TestRevokeRolePermissions(t *testing.T) {
+	auth := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: prefix_test,
+		DB:           db,
+	})
+
+	auth.CreateRole("role-a")
+	auth.CreatePermission("permission-a")
+	auth.CreatePermission("permission-b")
+	auth.CreatePermission("permission-c")
+	auth.AssignPermissions("role-a", []string{"permission-a", "permission-b", "permission-c"})
+
+	err := auth.RevokeRolePermissions("role-a", []string{"permission-a", "permission-b"})
+	if err != nil {
+		t.Error("unexpected error while revoking role permissions.", err)
+	}
+	roles, _ := auth.ListRolesWithPermission("permission-c", AuthorizationGo.ListOptions{})
+	if len(roles) != 1 {
+		t.Error("expecting permission-c to stay granted")
+	}
+	ok, _ := auth.CheckRolePermission("role-a", "permission-a")
+	if ok {
+		t.Error("expecting permission-a to be revoked")
+	}
+
+	err = auth.RevokeRolePermissions("role-aa", []string{"permission-c"})
+	if err != AuthorizationGo.ErrRoleNotFound {
+		t.Error("expecting ErrRoleNotFound when revoking from a missing role")
+	}
+	err = auth.RevokeRolePermissions("role-a", []string{"permission-cc"})
+	if err != AuthorizationGo.ErrPermissionNotFound {
+		t.Error("expecting ErrPermissionNotFound when revoking a missing permission")
+	}
+
+	// clean up
+	auth.DeleteRole("role-a", AuthorizationGo.WithPurge())
+	db.Unscoped().Where("name IN (?)", []string{"permission-a", "permission-b", "permission-c"}).Delete(&AuthorizationGo.Permission{})
+}
+
+func TestReconcile(t *testing.T) {
+	auth := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: prefix_test,
+		DB:           db,
+	})
+
+	auth.CreateRole("role-a")
+	auth.CreateRole("role-b")
+	auth.CreatePermission("permission-a")
+	auth.CreatePermission("permission-b")
+	auth.AssignPermissions("role-a", []string{"permission-a", "permission-b"})
+	auth.AssignRole(1, "role-a")
+	auth.AssignRole(2, "role-b")
+
+	desired := AuthorizationGo.Policy{
+		Roles: []AuthorizationGo.RolePolicy{
+			{Name: "role-a", Permissions: []string{"permission-a"}},
+			{Name: "role-c", Permissions: []string{"permission-c"}},
+		},
+		Users: []AuthorizationGo.UserPolicy{
+			{ID: 1, Roles: []string{"role-a", "role-c"}},
+		},
+	}
+
+	// planning does not change the tables
+	plan, err := auth.Reconcile(desired, AuthorizationGo.ReconcileOptions{Prune: true})
+	if err != nil {
+		t.Error("unexpected error while planning.", err)
+	}
+	expected := "+ permission permission-c\n" +
+		"+ role role-c\n" +
+		"+ grant role-c permission-c\n" +
+		"- assign 2 role-b\n" +
+		"+ assign 1 role-c\n" +
+		"- grant role-a permission-b\n" +
+		"- role role-b\n" +
+		"- permission permission-b\n" +
+		"Plan: 4 to add, 4 to delete.\n"
+	if plan == nil || plan.String() != expected {
+		t.Error("failed assert reconcile plan", plan)
+	}
+	ok, _ := auth.CheckRole(2, "role-b")
+	if !ok {
+		t.Error("expecting a plan not to apply the changes")
+	}
+
+	// without prune only the missing entries are created
+	plan, err = auth.Reconcile(desired, AuthorizationGo.ReconcileOptions{Apply: true})
+	if err != nil {
+		t.Error("unexpected error while reconciling.", err)
+	}
+	if plan == nil || len(plan.Changes) != 4 {
+		t.Error("failed assert reconcile without prune", plan)
+	}
+	ok, _ = auth.CheckPermission(1, "permission-c")
+	if !ok {
+		t.Error("expecting reconcile to assign role-c")
+	}
+	ok, _ = auth.CheckRole(2, "role-b")
+	if !ok {
+		t.Error("expecting reconcile without prune to keep role-b")
+	}
+
+	plan, err = auth.Reconcile(desired, AuthorizationGo.ReconcileOptions{Apply: true, Prune: true})
+	if err != nil {
+		t.Error("unexpected error while reconciling with prune.", err)
+	}
+	if plan == nil || len(plan.Changes) != 4 {
+		t.Error("failed assert reconcile with prune", plan)
+	}
+	ok, _ = auth.CheckPermission(1, "permission-b")
+	if ok {
+		t.Error("expecting reconcile to revoke permission-b from role-a")
+	}
+	_, err = auth.CheckRole(2, "role-b")
+	if err != AuthorizationGo.ErrRoleNotFound {
+		t.Error("expecting reconcile to delete role-b")
+	}
+
+	// the tables match the desired policy
+	plan, _ = auth.Reconcile(desired, AuthorizationGo.ReconcileOptions{Prune: true})
+	if plan == nil || !plan.Empty() {
+		t.Error("expecting an empty plan after reconciling", plan)
+	}
+
+	// clean up
+	for _, role := range []string{"role-a", "role-b", "role-c"} {
+		auth.DeleteRole(role, AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+	}
+	db.Unscoped().Where("name IN (?)", []string{"permission-a", "permission-b", "permission-c"}).Delete(&AuthorizationGo.Permission{})
+}
+
+func TestReconcilePrerequisites(t *testing.T) {
+	auth := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: prefix_test,
+		DB:           db,
+	})
+
+	// admin sorts before its prerequisite, author before its dependent
+	roleNames := []string{"admin", "author", "editor", "user"}
+	for _, role := range roleNames {
+		auth.CreateRole(role)
+	}
+	auth.AddRolePrerequisite("admin", "user")
+	auth.AddRolePrerequisite("editor", "author")
+
+	// the roles of a user are assigned together
+	err := auth.ImportPolicy(&AuthorizationGo.Policy{
+		Users: []AuthorizationGo.UserPolicy{{ID: 2, Roles: []string{"admin", "user"}}},
+	})
+	if err != nil {
+		t.Error("unexpected error while importing a role before its prerequisite.", err)
+	}
+
+	roles := []AuthorizationGo.RolePolicy{}
+	for _, role := range roleNames {
+		roles = append(roles, AuthorizationGo.RolePolicy{Name: role, Permissions: []string{}})
+	}
+	desired := AuthorizationGo.Policy{
+		Roles: roles,
+		Users: []AuthorizationGo.UserPolicy{
+			{ID: 1, Roles: roleNames},
+			{ID: 2, Roles: []string{"admin", "user"}},
+		},
+	}
+	if _, err := auth.Reconcile(desired, AuthorizationGo.ReconcileOptions{Apply: true}); err != nil {
+		t.Error("unexpected error while reconciling a role before its prerequisite.", err)
+	}
+	held, _ := auth.GetUserRoles(1)
+	if len(held) != 4 {
+		t.Error("failed assert reconciled roles", held)
+	}
+
+	// and revoked together
+	desired.Users = []AuthorizationGo.UserPolicy{}
+	if _, err := auth.Reconcile(desired, AuthorizationGo.ReconcileOptions{Apply: true, Prune: true}); err != nil {
+		t.Error("unexpected error while pruning a prerequisite before its dependent.", err)
+	}
+	held, _ = auth.GetUserRoles(1)
+	if len(held) != 0 {
+		t.Error("expecting prune to revoke every role", held)
+	}
+
+	// clean up
+	for _, role := range roleNames {
+		auth.DeleteRole(role, AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	auth := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: prefix_test,
+		DB:           db,
+	})
+
+	auth.CreateRole("role-a")
+	auth.CreateRole("role-b")
+	auth.CreatePermission("permission-a")
+	auth.CreatePermission("permission-b")
+	auth.AssignPermissions("role-a", []string{"permission-a", "permission-b"})
+	auth.AssignPermissions("role-b", []string{"permission-b"})
+	auth.AssignRole(1, "role-a")
+	auth.AssignRole(2, "role-a")
+	auth.AssignRole(2, "role-b")
+
+	var events []AuthorizationGo.Event
+	auth.OnEvent(func(e AuthorizationGo.Event) {
+		events = append(events, e)
+	})
+
+	changes := []AuthorizationGo.Change{
+		{Kind: AuthorizationGo.UngrantChange, Role: "role-a", Permission: "permission-b"},
+	}
+	sim, err := auth.Simulate(changes, []AuthorizationGo.Query{
+		{UserID: 1, Permission: "permission-b"},
+		{UserID: 2, Permission: "permission-b"},
+		{UserID: 1, Permission: "permission-x"},
+	})
+	if err != nil {
+		t.Fatal("unexpected error while simulating.", err)
+	}
+	expected := []AuthorizationGo.QueryResult{
+		{Query: AuthorizationGo.Query{UserID: 1, Permission: "permission-b"}, Before: true, BeforeRole: "role-a"},
+		{Query: AuthorizationGo.Query{UserID: 2, Permission: "permission-b"}, Before: true, After: true, BeforeRole: "role-a", AfterRole: "role-b"},
+		{Query: AuthorizationGo.Query{UserID: 1, Permission: "permission-x"}},
+	}
+	if !reflect.DeepEqual(sim.Results, expected) {
+		t.Error("failed assert simulation results", sim.Results)
+	}
+
+	// the simulation is rolled back
+	ok, _ := auth.CheckPermission(1, "permission-b")
+	if !ok || len(events) != 0 {
+		t.Error("expecting a simulation not to apply the changes", events)
+	}
+
+	// without queries the users losing or gaining a permission are flipped
+	sim, err = auth.Simulate([]AuthorizationGo.Change{
+		{Kind: AuthorizationGo.RevokeChange, UserID: 1, Role: "role-a"},
+		{Kind: AuthorizationGo.UngrantChange, Role: "role-a", Permission: "permission-a"},
+		{Kind: AuthorizationGo.AssignChange, UserID: 3, Role: "role-b"},
+	}, nil)
+	if err != nil {
+		t.Fatal("unexpected error while simulating.", err)
+	}
+	flipped := []AuthorizationGo.Query{}
+	for _, r := range sim.Flipped() {
+		flipped = append(flipped, r.Query)
+	}
+	expectedFlipped := []AuthorizationGo.Query{
+		{UserID: 1, Permission: "permission-a"},
+		{UserID: 1, Permission: "permission-b"},
+		{UserID: 2, Permission: "permission-a"},
+		{UserID: 3, Permission: "permission-b"},
+	}
+	if !reflect.DeepEqual(flipped, expectedFlipped) {
+		t.Error("failed assert flipped queries", flipped)
+	}
+
+	// a failing change fails the simulation
+	_, err = auth.Simulate([]AuthorizationGo.Change{
+		{Kind: AuthorizationGo.AssignChange, UserID: 1, Role: "role-x"},
+	}, nil)
+	if !errors.Is(err, AuthorizationGo.ErrRoleNotFound) {
+		t.Error("expecting the error of the change", err)
+	}
+
+	// clean up
+	auth.DeleteRole("role-a", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+	auth.DeleteRole("role-b", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+	auth.DeletePermission("permission-a", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+	auth.DeletePermission("permission-b", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+}
+
+func TestSnapshotDiff(t *testing.T) {
+	auth := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: prefix_test,
+		DB:           db,
+	})
+
+	auth.CreateRole("role-a")
+	auth.CreateRole("role-b")
+	auth.CreatePermission("permission-a")
+	auth.AssignPermissions("role-a", []string{"permission-a"})
+	auth.AssignRole(1, "role-a")
+	auth.AssignRole(2, "role-b")
+
+	from, err := auth.Snapshot()
+	if err != nil {
+		t.Fatal("unexpected error while taking a snapshot.", err)
+	}
+
+	auth.CreateRole("role-c")
+	auth.CreatePermission("permission-c")
+	auth.AssignPermissions("role-c", []string{"permission-c"})
+	auth.AssignRole(1, "role-c")
+	auth.DeleteRole("role-b", AuthorizationGo.WithCascade())
+
+	to, err := auth.Snapshot()
+	if err != nil {
+		t.Fatal("unexpected error while taking a snapshot.", err)
+	}
+
+	// the snapshot keeps the soft deleted roles
+	deleted := false
+	for _, role := range to.Roles {
+		deleted = deleted || role.Name == "role-b" && role.DeletedAt.Valid
+	}
+	if !deleted {
+		t.Error("expecting the snapshot to keep the deleted role-b")
+	}
+
+	// the snapshots survive a JSON round trip
+	data, err := json.Marshal(from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from = &AuthorizationGo.Snapshot{}
+	if err := json.Unmarshal(data, from); err != nil {
+		t.Fatal(err)
+	}
+
+	diff := AuthorizationGo.Diff(from, to)
+	from.TakenAt = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	diff.From, diff.To = from.TakenAt, from.TakenAt.AddDate(0, 3, 0)
+	expected := "Changes from 2024-01-01T00:00:00Z to 2024-04-01T00:00:00Z\n" +
+		"\nRoles:\n  + role-c\n  - role-b\n" +
+		"\nPermissions:\n  + permission-c\n" +
+		"\nGrants:\n  + role-c permission-c\n" +
+		"\nAssignments:\n  + 1 role-c\n  - 2 role-b\n" +
+		"\n4 added, 2 removed.\n"
+	if diff.String() != expected {
+		t.Error("failed assert diff report", diff.String())
+	}
+
+	data, err = json.Marshal(diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"added_grants":[{"role":"role-c","permission":"permission-c"}]`) ||
+		!strings.Contains(string(data), `"removed_assignments":[{"user_id":2,"role":"role-b"}]`) {
+		t.Error("failed assert diff JSON", string(data))
+	}
+
+	if !AuthorizationGo.Diff(to, to).Empty() {
+		t.Error("expecting no changes between a snapshot and itself")
+	}
+
+	// clean up
+	auth.DeleteRole("role-a", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+	auth.DeleteRole("role-b", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+	auth.DeleteRole("role-c", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+	auth.DeletePermission("permission-a", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+	auth.DeletePermission("permission-c", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+}
+
+func TestSnapshotConsistent(t *testing.T) {
+	auth := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: prefix_test,
+		DB:           db,
+	})
+
+	auth.CreateRole("role-a")
+	auth.AssignRole(1, "role-a")
+
+	// another connection commits a role and its assignment right after the
+	// roles are read, sqlite refuses the write while the snapshot is reading so
+	// this runs on postgres and mysql
+	armed := false
+	db.Callback().Query().After("gorm:query").Register("test:write", func(tx *gorm.DB) {
+		if armed && tx.Statement.Schema != nil && tx.Statement.Schema.Name == "Role" {
+			armed = false
+			auth.CreateRole("role-late")
+			auth.AssignRole(1, "role-late")
+		}
+	})
+	armed = true
+	snapshot, err := auth.Snapshot()
+	armed = false
+	db.Callback().Query().Remove("test:write")
+	if err != nil {
+		t.Fatal("unexpected error while taking a snapshot.", err)
+	}
+
+	roles := map[uint]bool{}
+	for _, role := range snapshot.Roles {
+		roles[role.ID] = true
+	}
+	for _, ur := range snapshot.UserRoles {
+		if !roles[ur.RoleID] {
+			t.Errorf("the snapshot has an assignment to the role %d it does not have", ur.RoleID)
+		}
+	}
+
+	// clean up
+	auth.DeleteRole("role-a", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+	auth.DeleteRole("role-late", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+}
+
+func TestSeparationOfDuty(t *testing.T) {
+	auth := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: prefix_test,
+		DB:           db,
+	})
+
+	auth.CreateRole("initiator")
+	auth.CreateRole("approver")
+	auth.CreateRole("auditor")
+	auth.CreatePermission("payments.create")
+	auth.CreatePermission("payments.approve")
+	auth.AssignPermissions("initiator", []string{"payments.create"})
+	auth.AssignPermissions("approver", []string{"payments.approve"})
+	auth.AssignRole(1, "initiator")
+	auth.AssignRole(1, "approver")
+
+	// a static conflict cannot be declared while a user holds both roles
+	err := auth.AddRoleConflict(AuthorizationGo.StaticConflict, "initiator", "approver")
+	if !errors.Is(err, AuthorizationGo.ErrRoleConflict) {
+		t.Error("expecting the holder of both roles to be reported", err)
+	}
+	err = auth.AddRoleConflict(AuthorizationGo.StaticConflict, "initiator", "initiator")
+	if !errors.Is(err, AuthorizationGo.ErrRoleConflictWithSelf) {
+		t.Error("expecting a role not to conflict with itself", err)
+	}
+
+	auth.RevokeRole(1, "approver")
+	if err := auth.AddRoleConflict(AuthorizationGo.StaticConflict, "initiator", "approver"); err != nil {
+		t.Error("unexpected error while adding a conflict.", err)
+	}
+	if err := auth.AddRoleConflict(AuthorizationGo.StaticConflict, "approver", "initiator"); err != nil {
+		t.Error("expecting a declared conflict to be ignored", err)
+	}
+	conflicts, _ := auth.GetRoleConflicts(AuthorizationGo.StaticConflict, "approver")
+	if !reflect.DeepEqual(conflicts, []string{"initiator"}) {
+		t.Error("failed assert role conflicts", conflicts)
+	}
+
+	// every assignment path enforces the static conflicts
+	if err := auth.AssignRole(1, "approver"); !errors.Is(err, AuthorizationGo.ErrRoleConflict) {
+		t.Error("expecting AssignRole to refuse the conflicting role", err)
+	}
+	if err := auth.AssignRoles(2, []string{"initiator", "approver"}); !errors.Is(err, AuthorizationGo.ErrRoleConflict) {
+		t.Error("expecting AssignRoles to refuse the conflicting roles", err)
+	}
+	if err := auth.AssignRoleToUsers("approver", []uint{2, 1}); !errors.Is(err, AuthorizationGo.ErrRoleConflict) {
+		t.Error("expecting AssignRoleToUsers to refuse the conflicting role", err)
+	}
+	auth.AssignRoles(3, []string{"initiator", "auditor"})
+	if err := auth.DeleteRole("auditor", AuthorizationGo.WithReassignTo("approver")); !errors.Is(err, AuthorizationGo.ErrRoleConflict) {
+		t.Error("expecting the reassignment to refuse the conflicting role", err)
+	}
+	ok, _ := auth.CheckRole(2, "approver")
+	if ok {
+		t.Error("expecting the failed assignments to be rolled back")
+	}
+	if err := auth.SetUserRoles(1, []string{"approver"}); err != nil {
+		t.Error("expecting SetUserRoles to revoke the conflicting role first", err)
+	}
+
+	// reconcile revokes the assignments before making the new ones, so the
+	// conflicting roles can be swapped both ways
+	for _, role := range []string{"initiator", "approver"} {
+		desired, _ := auth.ExportPolicy()
+		for i := range desired.Users {
+			if desired.Users[i].ID == 1 {
+				desired.Users[i].Roles = []string{role}
+			}
+		}
+		if _, err := auth.Reconcile(*desired, AuthorizationGo.ReconcileOptions{Apply: true, Prune: true}); err != nil {
+			t.Error("unexpected error while swapping conflicting roles.", err)
+		}
+		roles, _ := auth.GetUserRoles(1)
+		if !reflect.DeepEqual(roles, []string{role}) {
+			t.Error("failed assert swapped roles", roles)
+		}
+	}
+
+	// dynamic conflicts only apply to the active roles of a session
+	auth.RemoveRoleConflict(AuthorizationGo.StaticConflict, "initiator", "approver")
+	auth.AddRoleConflict(AuthorizationGo.DynamicConflict, "initiator", "approver")
+	if err := auth.AssignRole(1, "initiator"); err != nil {
+		t.Error("expecting a dynamic conflict not to restrict assignments", err)
+	}
+
+	_, err = auth.NewSession(1, "initiator", "approver")
+	if !errors.Is(err, AuthorizationGo.ErrRoleConflict) {
+		t.Error("expecting the conflicting roles not to be activated together", err)
+	}
+	_, err = auth.NewSession(2, "initiator")
+	if !errors.Is(err, AuthorizationGo.ErrRoleNotAssigned) {
+		t.Error("expecting only assigned roles to be activated", err)
+	}
+
+	session, err := auth.NewSession(1, "initiator")
+	if err != nil {
+		t.Fatal("unexpected error while starting a session.", err)
+	}
+	if err := session.ActivateRoles("approver"); !errors.Is(err, AuthorizationGo.ErrRoleConflict) {
+		t.Error("expecting the conflicting role not to be activated", err)
+	}
+	ok, _ = session.CheckPermission("payments.create")
+	if !ok {
+		t.Error("expecting the active role to grant its permission")
+	}
+	ok, _ = session.CheckPermission("payments.approve")
+	if ok {
+		t.Error("expecting the inactive role not to grant its permission")
+	}
+
+	session.DeactivateRole("initiator")
+	if err := session.ActivateRoles("approver"); err != nil {
+		t.Error("unexpected error while switching roles.", err)
+	}
+	if !reflect.DeepEqual(session.ActiveRoles(), []string{"approver"}) {
+		t.Error("failed assert active roles", session.ActiveRoles())
+	}
+	ok, _ = session.CheckPermission("payments.approve")
+	if !ok {
+		t.Error("expecting the activated role to grant its permission")
+	}
+
+	// a revoked role no longer grants its permissions in the session
+	auth.RevokeRole(1, "approver")
+	ok, _ = session.CheckPermission("payments.approve")
+	if ok {
+		t.Error("expecting the revoked role not to grant its permission")
+	}
+
+	// clean up, purging the roles drops their conflicts
+	auth.DeleteRole("initiator", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+	auth.DeleteRole("approver", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+	auth.DeleteRole("auditor", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+	var count int64
+	db.Model(&AuthorizationGo.RoleConflict{}).Count(&count)
+	if count != 0 {
+		t.Error("expecting the conflicts of the purged roles to be deleted", count)
+	}
+	auth.DeletePermission("payments.create", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+	auth.DeletePermission("payments.approve", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+}
+
+func TestAssignmentLimits(t *testing.T) {
+	auth := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: prefix_test,
+		DB:           db,
+	})
+
+	auth.CreateRole("super-admin")
+	auth.CreateRole("role-a")
+	auth.CreateRole("role-b")
+
+	if err := auth.SetRoleMaxHolders("super-admin", 2); err != nil {
+		t.Error("unexpected error while limiting a role.", err)
+	}
+	if err := auth.SetRoleMaxHolders("super-admin", 3); err != nil {
+		t.Error("unexpected error while updating a limit.", err)
+	}
+	max, _ := auth.GetRoleMaxHolders("super-admin")
+	if max != 3 {
+		t.Error("failed assert role limit", max)
+	}
+	if err := auth.SetRoleMaxHolders("role-x", 1); !errors.Is(err, AuthorizationGo.ErrRoleNotFound) {
+		t.Error("expecting a missing role not to be limited", err)
+	}
+
+	// the holders are limited across the assignment methods
+	if err := auth.AssignRoleToUsers("super-admin", []uint{1, 2, 3, 4}); !errors.Is(err, AuthorizationGo.ErrAssignmentLimit) {
+		t.Error("expecting the fourth holder to be refused", err)
+	}
+	if err := auth.AssignRoleToUsers("super-admin", []uint{1, 2, 3}); err != nil {
+		t.Error("unexpected error while assigning up to the limit.", err)
+	}
+	if err := auth.AssignRole(4, "super-admin"); !errors.Is(err, AuthorizationGo.ErrAssignmentLimit) {
+		t.Error("expecting AssignRole to refuse the fourth holder", err)
+	}
+	auth.AssignRole(4, "role-b")
+	if err := auth.DeleteRole("role-b", AuthorizationGo.WithReassignTo("super-admin")); !errors.Is(err, AuthorizationGo.ErrAssignmentLimit) {
+		t.Error("expecting the reassignment to refuse the fourth holder", err)
+	}
+	auth.RevokeRole(3, "super-admin")
+	if err := auth.AssignRole(4, "super-admin"); err != nil {
+		t.Error("expecting a revocation to free a seat", err)
+	}
+
+	// the roles of a user are limited
+	auth.SetUserMaxRoles(5, 1)
+	max, _ = auth.GetUserMaxRoles(5)
+	if max != 1 {
+		t.Error("failed assert user limit", max)
+	}
+	if err := auth.AssignRoles(5, []string{"role-a", "role-b"}); !errors.Is(err, AuthorizationGo.ErrAssignmentLimit) {
+		t.Error("expecting the second role to be refused", err)
+	}
+	if err := auth.AssignRole(5, "role-a"); err != nil {
+		t.Error("unexpected error while assigning up to the limit.", err)
+	}
+	if err := auth.AssignRole(5, "role-b"); !errors.Is(err, AuthorizationGo.ErrAssignmentLimit) {
+		t.Error("expecting AssignRole to refuse the second role", err)
+	}
+	if err := auth.SetUserRoles(5, []string{"role-b"}); err != nil {
+		t.Error("expecting SetUserRoles to revoke before counting", err)
+	}
+	auth.CreateRole("role-c")
+	auth.DeleteRole("role-b", AuthorizationGo.WithForce())
+	if err := auth.AssignRole(5, "role-c"); err != nil {
+		t.Error("expecting a deleted role not to be counted", err)
+	}
+	auth.RestoreRole("role-b")
+
+	// removing the limits lifts them
+	auth.SetUserMaxRoles(5, 0)
+	auth.SetRoleMaxHolders("super-admin", 0)
+	if err := auth.AssignRoles(5, []string{"role-a", "super-admin"}); err != nil {
+		t.Error("expecting the limits to be removed", err)
+	}
+
+	// clean up
+	auth.DeleteRole("super-admin", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+	auth.DeleteRole("role-a", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+	auth.DeleteRole("role-b", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+	auth.DeleteRole("role-c", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+}
+
+func TestRolePrerequisites(t *testing.T) {
+	auth := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: prefix_test,
+		DB:           db,
+	})
+
+	auth.CreateRole("employee")
+	auth.CreateRole("engineer")
+	auth.CreateRole("release-manager")
+	auth.AssignRole(1, "engineer")
+
+	// a prerequisite cannot be declared while a holder lacks it
+	err := auth.AddRolePrerequisite("engineer", "employee")
+	if !errors.Is(err, AuthorizationGo.ErrMissingPrerequisite) {
+		t.Error("expecting the holder lacking the prerequisite to be reported", err)
+	}
+	auth.AssignRole(1, "employee")
+	if err := auth.AddRolePrerequisite("engineer", "employee"); err != nil {
+		t.Error("unexpected error while adding a prerequisite.", err)
+	}
+	if err := auth.AddRolePrerequisite("release-manager", "engineer"); err != nil {
+		t.Error("unexpected error while adding a prerequisite.", err)
+	}
+	if err := auth.AddRolePrerequisite("employee", "release-manager"); !errors.Is(err, AuthorizationGo.ErrPrerequisiteCycle) {
+		t.Error("expecting the cycle to be refused", err)
+	}
+	if err := auth.AddRolePrerequisite("employee", "employee"); !errors.Is(err, AuthorizationGo.ErrPrerequisiteCycle) {
+		t.Error("expecting a role not to require itself", err)
+	}
+	prerequisites, _ := auth.GetRolePrerequisites("release-manager")
+	if !reflect.DeepEqual(prerequisites, []string{"engineer"}) {
+		t.Error("failed assert prerequisites", prerequisites)
+	}
+
+	// assignments require the prerequisites, assigned before or together
+	if err := auth.AssignRole(2, "engineer"); !errors.Is(err, AuthorizationGo.ErrMissingPrerequisite) {
+		t.Error("expecting the assignment without prerequisite to be refused", err)
+	}
+	if err := auth.AssignRoles(2, []string{"employee", "engineer"}); err != nil {
+		t.Error("expecting the prerequisite assigned together to count", err)
+	}
+	if err := auth.AssignRole(1, "release-manager"); err != nil {
+		t.Error("unexpected error while assigning with the prerequisites.", err)
+	}
+
+	// revoking a prerequisite is refused unless the dependents are revoked
+	if err := auth.RevokeRole(1, "employee"); !errors.Is(err, AuthorizationGo.ErrRoleRequired) {
+		t.Error("expecting the revocation of a prerequisite to be refused", err)
+	}
+	if err := auth.SetUserRoles(2, []string{"engineer"}); !errors.Is(err, AuthorizationGo.ErrRoleRequired) {
+		t.Error("expecting SetUserRoles to keep the prerequisites", err)
+	}
+	ok, _ := auth.CheckRole(1, "employee")
+	if !ok {
+		t.Error("expecting the refused revocation to be rolled back")
+	}
+
+	var events []AuthorizationGo.Event
+	auth.OnEvent(func(e AuthorizationGo.Event) {
+		events = append(events, e)
+	})
+	if err := auth.RevokeRole(1, "employee", AuthorizationGo.WithDependentRoles()); err != nil {
+		t.Error("unexpected error while revoking the dependents.", err)
+	}
+	roles, _ := auth.GetUserRoles(1)
+	if len(roles) != 0 {
+		t.Error("expecting the dependent roles to be revoked transitively", roles)
+	}
+	if len(events) != 3 || events[1].Role != "engineer" || events[2].Role != "release-manager" {
+		t.Error("failed assert revocation events", events)
+	}
+	if err := auth.RevokeRoles(2, []string{"employee", "engineer"}); err != nil {
+		t.Error("expecting the dependents revoked together to be allowed", err)
+	}
+
+	// deleting a role with cascade revokes the roles requiring it
+	auth.AssignRoles(3, []string{"employee", "engineer", "release-manager"})
+	n, err := auth.DeleteRoleCount("engineer", AuthorizationGo.WithCascade())
+	if err != nil || n != 2 {
+		t.Error("expecting the cascade to revoke the dependent role", n, err)
+	}
+	roles, _ = auth.GetUserRoles(3)
+	if !reflect.DeepEqual(roles, []string{"employee"}) {
+		t.Error("failed assert roles after the cascade", roles)
+	}
+
+	// restoring a role checks the roles requiring it, they can be assigned
+	// without it while it is deleted
+	if err := auth.AssignRole(3, "release-manager"); err != nil {
+		t.Error("expecting the prerequisite to be ignored while deleted", err)
+	}
+	if err := auth.RestoreRole("engineer"); !errors.Is(err, AuthorizationGo.ErrMissingPrerequisite) {
+		t.Error("expecting the dependent holder lacking the restored role to be reported", err)
+	}
+	auth.RevokeRole(3, "release-manager")
+	if err := auth.RestoreRole("engineer"); err != nil {
+		t.Error("unexpected error while restoring role.", err)
+	}
+
+	// and the prerequisites of its holders
+	auth.AssignRole(3, "engineer")
+	auth.DeleteRole("engineer", AuthorizationGo.WithForce())
+	auth.RevokeRole(3, "employee")
+	if err := auth.RestoreRole("engineer"); !errors.Is(err, AuthorizationGo.ErrMissingPrerequisite) {
+		t.Error("expecting the holder lacking the prerequisite to be reported", err)
+	}
+	auth.AssignRole(3, "employee")
+	if err := auth.RestoreRole("engineer"); err != nil {
+		t.Error("unexpected error while restoring role.", err)
+	}
+
+	// a reassigned role does not stand in as a prerequisite
+	err = auth.DeleteRole("employee", AuthorizationGo.WithReassignTo("release-manager"))
+	if !errors.Is(err, AuthorizationGo.ErrRoleRequired) {
+		t.Error("expecting the reassignment of a prerequisite to be refused", err)
+	}
+
+	// clean up, purging the roles drops their prerequisites
+	auth.DeleteRole("employee", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+	auth.DeleteRole("engineer", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+	auth.DeleteRole("release-manager", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+	var count int64
+	db.Model(&AuthorizationGo.RolePrerequisite{}).Count(&count)
+	if count != 0 {
+		t.Error("expecting the prerequisites of the purged roles to be deleted", count)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	auth := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: prefix_test,
+		DB:           db,
+	})
+
+	var events []AuthorizationGo.Event
+	auth.OnEvent(func(e AuthorizationGo.Event) {
+		events = append(events, e)
+	})
+	ch, cancel := auth.Subscribe()
+
+	auth.CreateRole("role-a")
+	auth.CreatePermission("permission-a")
+	auth.AssignPermissions("role-a", []string{"permission-a"})
+	auth.AssignRole(1, "role-a")
+	auth.RenameRole("role-a", "role-b")
+
+	expected := []AuthorizationGo.Event{
+		{Type: AuthorizationGo.RoleCreated, Role: "role-a"},
+		{Type: AuthorizationGo.PermissionCreated, Permission: "permission-a"},
+		{Type: AuthorizationGo.PermissionGranted, Role: "role-a", Permission: "permission-a"},
+		{Type: AuthorizationGo.RoleAssigned, Role: "role-a", UserID: 1},
+		{Type: AuthorizationGo.RoleRenamed, Role: "role-a", NewName: "role-b"},
+	}
+	if len(events) != len(expected) {
+		t.Fatal("failed assert hook events", events)
+	}
+	for i, e := range expected {
+		if events[i].Type != e.Type || events[i].Role != e.Role || events[i].Permission != e.Permission ||
+			events[i].UserID != e.UserID || events[i].NewName != e.NewName || events[i].Time.IsZero() {
+			t.Error("failed assert hook event", i, events[i])
+		}
+	}
+
+	// subscribers receive the same events in order
+	for i, e := range expected {
+		select {
+		case got := <-ch:
+			if got.Type != e.Type {
+				t.Error("failed assert subscribed event", i, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for subscribed event", i)
+		}
+	}
+
+	// failed mutations and no-ops do not emit events
+	events = nil
+	auth.AssignRole(1, "role-b")
+	auth.AssignRole(1, "role-x")
+	auth.RevokeRole(2, "role-b")
+	auth.ImportPolicy(&AuthorizationGo.Policy{
+		Roles: []AuthorizationGo.RolePolicy{{Name: "role-c"}},
+		Users: []AuthorizationGo.UserPolicy{{ID: 3, Roles: []string{"role-x"}}},
+	})
+	if len(events) != 0 {
+		t.Error("expecting no events from failed mutations", events)
+	}
+
+	// a cascading delete reports the revoked assignments
+	auth.DeleteRole("role-b", AuthorizationGo.WithCascade(), AuthorizationGo.WithPurge())
+	if len(events) != 2 || events[0].Type != AuthorizationGo.RoleRevoked || events[0].UserID != 1 ||
+		events[1].Type != AuthorizationGo.RoleDeleted {
+		t.Error("failed assert delete events", events)
+	}
+
+	cancel()
+	for range ch {
+	}
+
+	// clean up
+	db.Unscoped().Where("name = ?", "permission-a").Delete(&AuthorizationGo.Permission{})
+}
+
+func TestOutbox(t *testing.T) {
+	auth := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: prefix_test,
+		DB:           db,
+		Outbox:       true,
+	})
+
+	auth.CreateRole("role-a")
+	auth.CreatePermission("permission-a")
+	auth.AssignPermissions("role-a", []string{"permission-a"})
+	auth.AssignRole(1, "role-a")
+
+	// failed mutations are not recorded
+	auth.AssignRole(1, "role-a")
+	auth.ImportPolicy(&AuthorizationGo.Policy{
+		Roles: []AuthorizationGo.RolePolicy{{Name: "role-b"}},
+		Users: []AuthorizationGo.UserPolicy{{ID: 2, Roles: []string{"role-x"}}},
+	})
+
+	var count int64
+	db.Model(&AuthorizationGo.OutboxRecord{}).Count(&count)
+	if count != 4 {
+		t.Error("failed assert outbox records", count)
+	}
+
+	// records stay in the outbox when publishing fails
+	relay := auth.NewRelay(AuthorizationGo.PublisherFunc(func(ctx context.Context, records []AuthorizationGo.OutboxRecord) error {
+		return errors.New("unavailable")
+	}), AuthorizationGo.RelayOptions{BatchSize: 3})
+	_, err := relay.Flush(context.Background())
+	if err == nil {
+		t.Error("expecting the publisher error")
+	}
+	db.Model(&AuthorizationGo.OutboxRecord{}).Count(&count)
+	if count != 4 {
+		t.Error("expecting the outbox to be kept", count)
+	}
+
+	var published []AuthorizationGo.Event
+	relay = auth.NewRelay(AuthorizationGo.PublisherFunc(func(ctx context.Context, records []AuthorizationGo.OutboxRecord) error {
+		for _, record := range records {
+			published = append(published, record.Event())
+		}
+		return nil
+	}), AuthorizationGo.RelayOptions{BatchSize: 3})
+	n, err := relay.Flush(context.Background())
+	if err != nil || n != 4 {
+		t.Error("failed assert flushing the outbox", n, err)
+	}
+	if len(published) != 4 || published[0].Type != AuthorizationGo.RoleCreated ||
+		published[3].Type != AuthorizationGo.RoleAssigned || published[3].UserID != 1 {
+		t.Error("failed assert published events", published)
+	}
+	db.Model(&AuthorizationGo.OutboxRecord{}).Count(&count)
+	if count != 0 {
+		t.Error("expecting published records to be deleted", count)
+	}
+
+	// clean up
+	auth.DeleteRole("role-a", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+	db.Unscoped().Where("name = ?", "permission-a").Delete(&AuthorizationGo.Permission{})
+	db.Where("1 = 1").Delete(&AuthorizationGo.OutboxRecord{})
+}
+
+func TestCache(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// two instances sharing the database and the invalidations
+	transport := AuthorizationGo.NewMemoryTransport()
+	auth := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: prefix_test,
+		DB:           db,
+	})
+	auth.EnableCache(ctx, AuthorizationGo.CacheOptions{Transport: transport})
+	other := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: prefix_test,
+		DB:           db,
+	})
+	other.EnableCache(ctx, AuthorizationGo.CacheOptions{Transport: transport})
+	// let the instances start listening
+	time.Sleep(10 * time.Millisecond)
+
+	auth.CreateRole("role-a")
+	auth.CreatePermission("permission-a")
+	auth.AssignPermissions("role-a", []string{"permission-a"})
+
+	ok, _ := other.CheckPermission(1, "permission-a")
+	if ok {
+		t.Error("expecting permission-a not to be granted yet")
+	}
+
+	// a direct change is not seen while the decision is cached
+	db.Create(&AuthorizationGo.UserRole{UserID: 1, RoleID: roleID(t, "role-a")})
+	ok, _ = other.CheckPermission(1, "permission-a")
+	if ok {
+		t.Error("expecting the decision to be cached")
+	}
+	db.Where("user_id = ?", 1).Delete(&AuthorizationGo.UserRole{})
+
+	// a change made by the other instance invalidates the cache
+	if err := auth.AssignRole(1, "role-a"); err != nil {
+		t.Error("unexpected error while assigning role-a.", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for ok, _ = other.CheckPermission(1, "permission-a"); !ok && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		ok, _ = other.CheckPermission(1, "permission-a")
+	}
+	if !ok {
+		t.Error("expecting the assignment to invalidate the other cache")
+	}
+
+	// a change made by the instance invalidates its own cache at once
+	auth.CheckPermission(1, "permission-a")
+	auth.RevokeRolePermission("role-a", "permission-a")
+	ok, _ = auth.CheckPermission(1, "permission-a")
+	if ok {
+		t.Error("expecting the revocation to invalidate the cache")
+	}
+
+	// errors are not cached
+	_, err := auth.CheckPermission(1, "permission-b")
+	if err != AuthorizationGo.ErrPermissionNotFound {
+		t.Error("expecting ErrPermissionNotFound")
+	}
+	auth.CreatePermission("permission-b")
+	_, err = auth.CheckPermission(1, "permission-b")
+	if err != nil {
+		t.Error("expecting the created permission to be found", err)
+	}
+
+	// clean up
+	auth.DeleteRole("role-a", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+	db.Unscoped().Where("name IN (?)", []string{"permission-a", "permission-b"}).Delete(&AuthorizationGo.Permission{})
+}
+
+// recordingTransport hands the published invalidations to a channel
+type recordingTransport chan AuthorizationGo.Invalidation
+
+func (r recordingTransport) Publish(ctx context.Context, inv AuthorizationGo.Invalidation) error {
+	r <- inv
+	return nil
+}
+
+func (r recordingTransport) Listen(ctx context.Context, fn func(AuthorizationGo.Invalidation)) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestCacheInvalidationPerMutation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	transport := make(recordingTransport, 10)
+	auth := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: prefix_test,
+		DB:           db,
+	})
+	auth.EnableCache(ctx, AuthorizationGo.CacheOptions{Transport: transport})
+
+	// creations do not invalidate anything
+	auth.CreateRole("role-a")
+
+	// the assignments of a mutation are published as one invalidation
+	if err := auth.AssignRoleToUsers("role-a", []uint{1, 2, 3}); err != nil {
+		t.Error("unexpected error while assigning role-a.", err)
+	}
+	select {
+	case inv := <-transport:
+		if inv.All || !reflect.DeepEqual(inv.UserIDs, []uint{1, 2, 3}) {
+			t.Error("failed assert merged invalidation", inv)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for the invalidation")
+	}
+	select {
+	case inv := <-transport:
+		t.Error("expecting a single invalidation, got another one", inv)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// clean up
+	auth.DeleteRole("role-a", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+	select {
+	case inv := <-transport:
+		if !inv.All {
+			t.Error("expecting the deletion to invalidate every decision", inv)
+		}
+	case <-time.After(time.Second):
+		t.Error("timeout waiting for the invalidation of the deletion")
+	}
+}
+
+func roleID(t *testing.T, name string) uint {
+	var role AuthorizationGo.Role
+	if err := db.Where("name = ?", name).First(&role).Error; err != nil {
+		t.Fatal(err)
+	}
+	return role.ID
+}
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	auth := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix:   prefix_test,
+		DB:             db,
+		TracerProvider: provider,
+	})
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "request")
+	err := auth.WithContext(ctx).ImportPolicy(&AuthorizationGo.Policy{
+		Roles: []AuthorizationGo.RolePolicy{{Name: "role-a", Permissions: []string{"permission-a"}}},
+		Users: []AuthorizationGo.UserPolicy{{ID: 1, Roles: []string{"role-a"}}},
+	})
+	if err != nil {
+		t.Error("unexpected error while importing policy.", err)
+	}
+	auth.WithContext(ctx).CheckPermission(1, "permission-a")
+	auth.WithContext(ctx).CheckPermission(1, "permission-x")
+	AuthorizationGo.CheckerWithContext(ctx, auth).CheckRole(1, "role-a")
+	parent.End()
+
+	spans := map[string][]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = append(spans[span.Name()], span)
+	}
+
+	// the operations nest under the caller span and the nested calls under
+	// the operation
+	importSpan := spans["AuthorizationX.ImportPolicy"]
+	if len(importSpan) != 1 || importSpan[0].Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Fatal("expecting ImportPolicy to be a child of the request span")
+	}
+	assignSpan := spans["AuthorizationX.AssignRoles"]
+	if len(assignSpan) != 1 || assignSpan[0].Parent().SpanID() != importSpan[0].SpanContext().SpanID() {
+		t.Error("expecting AssignRoles to be a child of ImportPolicy")
+	}
+
+	// the checks of the middleware adapters nest under the request span
+	roleChecks := spans["AuthorizationX.CheckRole"]
+	if len(roleChecks) != 1 || roleChecks[0].Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Error("expecting the check of a bound checker to be a child of the request span")
+	}
+
+	checks := spans["AuthorizationX.CheckPermission"]
+	if len(checks) != 2 {
+		t.Fatal("expecting a span per check", len(checks))
+	}
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range checks[0].Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	if attrs["authorization.user_id"].AsInt64() != 1 || attrs["authorization.permission"].AsString() != "permission-a" ||
+		!attrs["authorization.allowed"].AsBool() {
+		t.Error("failed assert check span attributes", checks[0].Attributes())
+	}
+	if checks[1].Status().Code != codes.Error || len(checks[1].Events()) == 0 {
+		t.Error("expecting the failed check to record the error", checks[1].Status())
+	}
+
+	// nothing is traced by default
+	recorder = tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	AuthorizationGo.New(AuthorizationGo.AuthOption{TablesPrefix: prefix_test, DB: db}).CheckPermission(1, "permission-a")
+	if len(recorder.Ended()) != 0 {
+		t.Error("expecting no spans without a tracer provider")
+	}
+
+	// clean up
+	auth.DeleteRole("role-a", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+	db.Unscoped().Where("name = ?", "permission-a").Delete(&AuthorizationGo.Permission{})
+}
@@ -0,0 +1,132 @@
+// Package authpg shares the AuthorizationGo cache invalidations between the
+// instances using the same Postgres database through LISTEN/NOTIFY
+package authpg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	AuthorizationGo "github.com/SoegiDev/AuthorizationGo"
+	"github.com/jackc/pgx/v5"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// DefaultChannel is the notification channel used when Options.Channel is
+// empty
+const DefaultChannel = "authorization_invalidations"
+
+// maxPayload is the size of the largest notification payload postgres accepts
+const maxPayload = 7999
+
+var ErrMissingDSN = errors.New("missing DSN to listen for notifications")
+
+type Options struct {
+	// Channel is the notification channel, DefaultChannel by default
+	Channel string
+	// DSN of the listening connection, by default the DSN the gorm
+	// postgres dialector was opened with
+	DSN string
+	// RetryInterval is the time between two reconnections, 1s by default
+	RetryInterval time.Duration
+	// OnError is called when the listening connection fails before it is
+	// reconnected
+	OnError func(error)
+}
+
+// Transport is an AuthorizationGo.InvalidationTransport notifying through the
+// gorm connection and listening on a dedicated pgx connection
+type Transport struct {
+	db   *gorm.DB
+	opts Options
+}
+
+var _ AuthorizationGo.InvalidationTransport = (*Transport)(nil)
+
+func New(db *gorm.DB, opts Options) *Transport {
+	if opts.Channel == "" {
+		opts.Channel = DefaultChannel
+	}
+	if opts.DSN == "" {
+		if dialector, ok := db.Dialector.(*postgres.Dialector); ok {
+			opts.DSN = dialector.Config.DSN
+		}
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = time.Second
+	}
+
+	return &Transport{db: db, opts: opts}
+}
+
+// Publish notifies the listeners of the channel, an invalidation too large for
+// a notification is published with All set instead
+func (t *Transport) Publish(ctx context.Context, inv AuthorizationGo.Invalidation) error {
+	payload, err := json.Marshal(inv)
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxPayload {
+		if payload, err = json.Marshal(AuthorizationGo.Invalidation{All: true}); err != nil {
+			return err
+		}
+	}
+
+	return t.db.WithContext(ctx).Exec("SELECT pg_notify(?, ?)", t.opts.Channel, string(payload)).Error
+}
+
+// Listen calls fn with the notifications of the channel until ctx is done, the
+// connection is reopened when it fails and fn is called with All set since
+// notifications may have been missed meanwhile
+func (t *Transport) Listen(ctx context.Context, fn func(AuthorizationGo.Invalidation)) error {
+	if t.opts.DSN == "" {
+		return ErrMissingDSN
+	}
+
+	for reconnect := false; ; reconnect = true {
+		err := t.listen(ctx, fn, reconnect)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if t.opts.OnError != nil {
+			t.opts.OnError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(t.opts.RetryInterval):
+		}
+	}
+}
+
+func (t *Transport) listen(ctx context.Context, fn func(AuthorizationGo.Invalidation), reconnect bool) error {
+	conn, err := pgx.Connect(ctx, t.opts.DSN)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{t.opts.Channel}.Sanitize()); err != nil {
+		return err
+	}
+	if reconnect {
+		fn(AuthorizationGo.Invalidation{All: true})
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var inv AuthorizationGo.Invalidation
+		if err := json.Unmarshal([]byte(notification.Payload), &inv); err != nil {
+			// unknown payload, drop everything to be safe
+			inv = AuthorizationGo.Invalidation{All: true}
+		}
+		fn(inv)
+	}
+}
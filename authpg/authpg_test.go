@@ -0,0 +1,89 @@
+package authpg_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	AuthorizationGo "github.com/SoegiDev/AuthorizationGo"
+	"github.com/SoegiDev/AuthorizationGo/authpg"
+	"github.com/SoegiDev/AuthorizationGo/internal/testdb"
+	"gorm.io/gorm"
+)
+
+func TestTransport(t *testing.T) {
+	if os.Getenv("AUTHZ_TEST_DRIVER") != "postgres" {
+		t.Skip("LISTEN/NOTIFY needs AUTHZ_TEST_DRIVER=postgres")
+	}
+
+	db, err := testdb.Open("authpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	transport := authpg.New(db, authpg.Options{Channel: "authpg_test"})
+	received := make(chan AuthorizationGo.Invalidation, 1)
+	go transport.Listen(ctx, func(inv AuthorizationGo.Invalidation) {
+		received <- inv
+	})
+
+	// notifications sent before LISTEN runs are lost, publish until one is
+	// received
+	for i := 0; i < 50; i++ {
+		err = transport.Publish(ctx, AuthorizationGo.Invalidation{UserIDs: []uint{7}})
+		if err != nil {
+			t.Fatal("unexpected error while publishing.", err)
+		}
+
+		select {
+		case inv := <-received:
+			if len(inv.UserIDs) != 1 || inv.UserIDs[0] != 7 || inv.All {
+				t.Error("failed assert received invalidation", inv)
+			}
+			return
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	t.Error("timeout waiting for the notification")
+}
+
+func TestPublishLarge(t *testing.T) {
+	db, err := testdb.Open("authpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// record the payload without sending it
+	var payload string
+	db.Callback().Raw().Before("gorm:raw").Register("test:payload", func(tx *gorm.DB) {
+		payload, _ = tx.Statement.Vars[1].(string)
+	})
+	transport := authpg.New(db.Session(&gorm.Session{DryRun: true}), authpg.Options{})
+
+	inv := AuthorizationGo.Invalidation{}
+	for i := 0; i < 500; i++ {
+		inv.UserIDs = append(inv.UserIDs, ^uint(0)-uint(i))
+	}
+	if err := transport.Publish(context.Background(), inv); err != nil {
+		t.Fatal("unexpected error while publishing.", err)
+	}
+	if len(payload) >= 8000 {
+		t.Fatal("the payload is too large for a notification", len(payload))
+	}
+	var published AuthorizationGo.Invalidation
+	if err := json.Unmarshal([]byte(payload), &published); err != nil || !published.All {
+		t.Error("expecting a large invalidation to be published with All set", payload)
+	}
+
+	inv.UserIDs = inv.UserIDs[:3]
+	transport.Publish(context.Background(), inv)
+	published = AuthorizationGo.Invalidation{}
+	if err := json.Unmarshal([]byte(payload), &published); err != nil || published.All || len(published.UserIDs) != 3 {
+		t.Error("expecting a small invalidation to be published as is", payload)
+	}
+}
@@ -0,0 +1,101 @@
+// Package authprom exposes metrics of the AuthorizationGo decisions through a
+// prometheus.Collector
+package authprom
+
+import (
+	AuthorizationGo "github.com/SoegiDev/AuthorizationGo"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type Options struct {
+	// Namespace prefixes the metric names, "authorization" by default
+	Namespace string
+	// Buckets of the latency histogram, prometheus.DefBuckets by default
+	Buckets []float64
+	// ConstLabels are added to every metric
+	ConstLabels prometheus.Labels
+}
+
+// Collector counts the decisions by check, name and result, measures their
+// latency and counts the cache hits and misses. The name label is the
+// permission, or the role for CheckRole.
+type Collector struct {
+	decisions *prometheus.CounterVec
+	latency   *prometheus.HistogramVec
+	cache     *prometheus.CounterVec
+}
+
+var _ prometheus.Collector = (*Collector)(nil)
+
+// New returns a collector observing the decisions of auth, it still has to be
+// registered
+func New(auth *AuthorizationGo.AuthorizationX, opts Options) *Collector {
+	if opts.Namespace == "" {
+		opts.Namespace = "authorization"
+	}
+	if opts.Buckets == nil {
+		opts.Buckets = prometheus.DefBuckets
+	}
+
+	c := &Collector{
+		decisions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   opts.Namespace,
+			Name:        "decisions_total",
+			Help:        "Number of authorization decisions by check, name and result (allow, deny or error).",
+			ConstLabels: opts.ConstLabels,
+		}, []string{"check", "name", "result"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   opts.Namespace,
+			Name:        "decision_duration_seconds",
+			Help:        "Latency of the authorization decisions by check.",
+			Buckets:     opts.Buckets,
+			ConstLabels: opts.ConstLabels,
+		}, []string{"check"}),
+		cache: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   opts.Namespace,
+			Name:        "cache_requests_total",
+			Help:        "Number of decision cache lookups by check and result (hit or miss).",
+			ConstLabels: opts.ConstLabels,
+		}, []string{"check", "result"}),
+	}
+
+	auth.OnDecision(c.observe)
+	return c
+}
+
+func (c *Collector) observe(d AuthorizationGo.Decision) {
+	check := string(d.Check)
+
+	name := d.Permission
+	if d.Check == AuthorizationGo.RoleCheck {
+		name = d.Role
+	}
+	result := "deny"
+	switch {
+	case d.Err != nil:
+		result = "error"
+	case d.Allowed:
+		result = "allow"
+	}
+	c.decisions.WithLabelValues(check, name, result).Inc()
+	c.latency.WithLabelValues(check).Observe(d.Duration.Seconds())
+
+	switch d.Cache {
+	case AuthorizationGo.CacheHit:
+		c.cache.WithLabelValues(check, "hit").Inc()
+	case AuthorizationGo.CacheMiss:
+		c.cache.WithLabelValues(check, "miss").Inc()
+	}
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.decisions.Describe(ch)
+	c.latency.Describe(ch)
+	c.cache.Describe(ch)
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.decisions.Collect(ch)
+	c.latency.Collect(ch)
+	c.cache.Collect(ch)
+}
@@ -0,0 +1,105 @@
+package authprom_test
+
+import (
+	"context"
+	"testing"
+
+	AuthorizationGo "github.com/SoegiDev/AuthorizationGo"
+	"github.com/SoegiDev/AuthorizationGo/authprom"
+	"github.com/SoegiDev/AuthorizationGo/internal/testdb"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestCollector(t *testing.T) {
+	db, err := testdb.Open("authprom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: "authGo_prom_",
+		DB:           db,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	auth.EnableCache(ctx, AuthorizationGo.CacheOptions{})
+
+	collector := authprom.New(auth, authprom.Options{})
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(collector); err != nil {
+		t.Fatal(err)
+	}
+
+	auth.CreateRole("role-a")
+	auth.CreatePermission("permission-a")
+	auth.AssignPermissions("role-a", []string{"permission-a"})
+	auth.AssignRole(1, "role-a")
+
+	auth.CheckPermission(1, "permission-a")
+	auth.CheckPermission(1, "permission-a")
+	auth.CheckPermission(2, "permission-a")
+	auth.CheckPermission(1, "permission-x")
+	auth.CheckRole(1, "role-a")
+	auth.CheckRolePermission("role-a", "permission-a")
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		labels map[string]string
+		count  float64
+	}{
+		{map[string]string{"check": "permission", "name": "permission-a", "result": "allow"}, 2},
+		{map[string]string{"check": "permission", "name": "permission-a", "result": "deny"}, 1},
+		{map[string]string{"check": "permission", "name": "permission-x", "result": "error"}, 1},
+		{map[string]string{"check": "role", "name": "role-a", "result": "allow"}, 1},
+		{map[string]string{"check": "role_permission", "name": "permission-a", "result": "allow"}, 1},
+	}
+	for _, e := range expected {
+		got := counterValue(families, "authorization_decisions_total", e.labels)
+		if got != e.count {
+			t.Error("failed assert decisions", e.labels, got)
+		}
+	}
+
+	if n := testutil.CollectAndCount(collector, "authorization_decision_duration_seconds"); n != 3 {
+		t.Error("expecting a latency histogram per check", n)
+	}
+
+	// only the second permission-a check of user 1 hits the cache
+	hits := counterValue(families, "authorization_cache_requests_total", map[string]string{"result": "hit"})
+	misses := counterValue(families, "authorization_cache_requests_total", map[string]string{"result": "miss"})
+	if hits != 1 || misses != 4 {
+		t.Error("failed assert cache hits and misses", hits, misses)
+	}
+
+	// clean up
+	auth.DeleteRole("role-a", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+	auth.DeletePermission("permission-a", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+}
+
+// counterValue sums the counters of the family having the labels
+func counterValue(families []*dto.MetricFamily, name string, labels map[string]string) float64 {
+	var sum float64
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			matches := 0
+			for _, l := range m.GetLabel() {
+				if labels[l.GetName()] == l.GetValue() {
+					matches++
+				}
+			}
+			if matches == len(labels) {
+				sum += m.GetCounter().GetValue()
+			}
+		}
+	}
+
+	return sum
+}
@@ -0,0 +1,119 @@
+// Package authslog writes the AuthorizationGo decisions to a slog.Logger
+package authslog
+
+import (
+	"context"
+	"log/slog"
+	"math/rand"
+
+	AuthorizationGo "github.com/SoegiDev/AuthorizationGo"
+)
+
+type Options struct {
+	// Message of the records, "authorization decision" by default
+	Message string
+	// Sample tells whether a decision is logged, every decision is logged by
+	// default
+	Sample func(AuthorizationGo.Decision) bool
+	// Redact rewrites the attributes before they are logged, returning an
+	// empty attribute drops it
+	Redact func(slog.Attr) slog.Attr
+}
+
+// New returns a decision hook logging to logger, allowed decisions are logged
+// at the info level, denied ones at the warn level and failed ones at the
+// error level. It is registered with OnDecision:
+//
+//	auth.OnDecision(authslog.New(logger, authslog.Options{}))
+func New(logger *slog.Logger, opts Options) func(AuthorizationGo.Decision) {
+	if opts.Message == "" {
+		opts.Message = "authorization decision"
+	}
+
+	return func(d AuthorizationGo.Decision) {
+		level := levelOf(d)
+		if !logger.Enabled(context.Background(), level) {
+			return
+		}
+		if opts.Sample != nil && !opts.Sample(d) {
+			return
+		}
+
+		attrs := make([]slog.Attr, 0, 9)
+		add := func(attr slog.Attr) {
+			if opts.Redact != nil {
+				attr = opts.Redact(attr)
+			}
+			if attr.Key != "" {
+				attrs = append(attrs, attr)
+			}
+		}
+
+		add(slog.String("check", string(d.Check)))
+		if d.Check != AuthorizationGo.RolePermissionCheck {
+			add(slog.Uint64("user_id", uint64(d.UserID)))
+		}
+		if d.Role != "" {
+			add(slog.String("role", d.Role))
+		}
+		if d.Permission != "" {
+			add(slog.String("permission", d.Permission))
+		}
+		add(slog.String("outcome", Outcome(d)))
+		if d.MatchedRole != "" {
+			add(slog.String("matched_role", d.MatchedRole))
+		}
+		switch d.Cache {
+		case AuthorizationGo.CacheHit:
+			add(slog.String("cache", "hit"))
+		case AuthorizationGo.CacheMiss:
+			add(slog.String("cache", "miss"))
+		}
+		add(slog.Duration("latency", d.Duration))
+		if d.Err != nil {
+			add(slog.String("error", d.Err.Error()))
+		}
+
+		logger.LogAttrs(context.Background(), level, opts.Message, attrs...)
+	}
+}
+
+// Outcome is "allow", "deny" or "error"
+func Outcome(d AuthorizationGo.Decision) string {
+	switch {
+	case d.Err != nil:
+		return "error"
+	case d.Allowed:
+		return "allow"
+	}
+	return "deny"
+}
+
+func levelOf(d AuthorizationGo.Decision) slog.Level {
+	switch {
+	case d.Err != nil:
+		return slog.LevelError
+	case d.Allowed:
+		return slog.LevelInfo
+	}
+	return slog.LevelWarn
+}
+
+// SampleAllowed logs the given fraction of the allowed decisions, the denied
+// and failed ones are always logged
+func SampleAllowed(rate float64) func(AuthorizationGo.Decision) bool {
+	return func(d AuthorizationGo.Decision) bool {
+		if d.Err != nil || !d.Allowed {
+			return true
+		}
+		return rand.Float64() < rate
+	}
+}
+
+// RedactUser replaces the user ID by a constant
+func RedactUser(attr slog.Attr) slog.Attr {
+	if attr.Key == "user_id" {
+		return slog.String("user_id", "[redacted]")
+	}
+	return attr
+}
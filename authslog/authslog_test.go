@@ -0,0 +1,87 @@
+package authslog_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	AuthorizationGo "github.com/SoegiDev/AuthorizationGo"
+	"github.com/SoegiDev/AuthorizationGo/authslog"
+	"github.com/SoegiDev/AuthorizationGo/internal/testdb"
+)
+
+func TestLogger(t *testing.T) {
+	db, err := testdb.Open("authslog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: "authGo_slog_",
+		DB:           db,
+	})
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	auth.OnDecision(authslog.New(logger, authslog.Options{
+		Sample: authslog.SampleAllowed(0),
+		Redact: func(attr slog.Attr) slog.Attr {
+			if attr.Key == "latency" {
+				return slog.Attr{}
+			}
+			return authslog.RedactUser(attr)
+		},
+	}))
+
+	auth.CreateRole("role-a")
+	auth.CreateRole("role-b")
+	auth.CreatePermission("permission-a")
+	auth.AssignPermissions("role-a", []string{"permission-a"})
+	auth.AssignPermissions("role-b", []string{"permission-a"})
+	auth.AssignRole(1, "role-b")
+
+	// the allowed check is sampled out
+	auth.CheckPermission(1, "permission-a")
+	auth.CheckPermission(2, "permission-a")
+	auth.CheckPermission(1, "permission-x")
+
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 2 {
+		t.Fatal("expecting the denied and failed decisions", records)
+	}
+	if records[0]["level"] != "WARN" || records[0]["outcome"] != "deny" || records[0]["permission"] != "permission-a" {
+		t.Error("failed assert denied decision", records[0])
+	}
+	if records[1]["level"] != "ERROR" || records[1]["outcome"] != "error" || records[1]["error"] == nil {
+		t.Error("failed assert failed decision", records[1])
+	}
+	for _, record := range records {
+		if record["user_id"] != "[redacted]" {
+			t.Error("failed assert user redaction", record)
+		}
+		if _, ok := record["latency"]; ok {
+			t.Error("failed assert dropped attribute", record)
+		}
+	}
+
+	// the matched role is logged when every decision is
+	buf.Reset()
+	auth.OnDecision(authslog.New(logger, authslog.Options{}))
+	auth.CheckPermission(1, "permission-a")
+	if !strings.Contains(buf.String(), `"matched_role":"role-b"`) || !strings.Contains(buf.String(), `"user_id":1`) {
+		t.Error("failed assert matched role", buf.String())
+	}
+
+	// clean up
+	auth.DeleteRole("role-a", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+	auth.DeleteRole("role-b", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+	auth.DeletePermission("permission-a", AuthorizationGo.WithForce(), AuthorizationGo.WithPurge())
+}
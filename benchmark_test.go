@@ -0,0 +1,200 @@
+package AuthorizationGo_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	AuthorizationGo "github.com/SoegiDev/AuthorizationGo"
+	"gorm.io/gorm"
+)
+
+// benchUser holds the roles of the benchmarks, it is not used by the tests
+const benchUser = 9001
+
+// setupBenchmark creates roles roles with perms permissions each and assigns
+// all of them to benchUser, the names start with bench- so the clean up only
+// deletes the rows of the benchmark
+func setupBenchmark(b *testing.B, roles int, perms int) *AuthorizationGo.AuthorizationX {
+	auth := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: prefix_test,
+		DB:           db,
+	})
+
+	for r := 0; r < roles; r++ {
+		roleName := fmt.Sprintf("bench-role-%d", r)
+		auth.CreateRole(roleName)
+
+		var permNames []string
+		for p := 0; p < perms; p++ {
+			permName := fmt.Sprintf("bench-permission-%d-%d", r, p)
+			auth.CreatePermission(permName)
+			permNames = append(permNames, permName)
+		}
+		auth.AssignPermissions(roleName, permNames)
+		auth.AssignRole(benchUser, roleName)
+	}
+
+	b.Cleanup(func() {
+		roleIDs := db.Unscoped().Model(&AuthorizationGo.Role{}).Select("id").Where("name LIKE ?", "bench-%")
+		db.Where("user_id = ?", benchUser).Delete(AuthorizationGo.UserRole{})
+		db.Where("role_id IN (?)", roleIDs).Delete(AuthorizationGo.RolePermission{})
+		db.Unscoped().Where("name LIKE ?", "bench-%").Delete(&AuthorizationGo.Role{})
+		db.Unscoped().Where("name LIKE ?", "bench-%").Delete(&AuthorizationGo.Permission{})
+	})
+
+	return auth
+}
+
+// checkPermissionThreeQueries is the CheckPermission implementation looking up
+// the user roles, the permission and the grant separately, kept as a baseline
+func checkPermissionThreeQueries(userID uint, permName string) (bool, error) {
+	var userRoles []AuthorizationGo.UserRole
+	db.Where("user_id = ?", userID).Where("role_id IN (?)", db.Model(&AuthorizationGo.Role{}).Select("id")).Find(&userRoles)
+
+	var roleIDs []uint
+	for _, r := range userRoles {
+		roleIDs = append(roleIDs, r.RoleID)
+	}
+
+	var perm AuthorizationGo.Permission
+	res := db.Where("name = ?", permName).First(&perm)
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return false, AuthorizationGo.ErrPermissionNotFound
+	}
+
+	var rolePermission AuthorizationGo.RolePermission
+	res = db.Where("role_id IN (?)", roleIDs).Where("permission_id = ?", perm.ID).First(&rolePermission)
+	return res.Error == nil, nil
+}
+
+func BenchmarkCheckPermission(b *testing.B) {
+	auth := setupBenchmark(b, 10, 20)
+
+	b.Run("single-query", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if ok, err := auth.CheckPermission(benchUser, "bench-permission-9-19"); !ok || err != nil {
+				b.Fatal("expecting the permission to be granted", err)
+			}
+		}
+	})
+
+	b.Run("three-queries", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if ok, err := checkPermissionThreeQueries(benchUser, "bench-permission-9-19"); !ok || err != nil {
+				b.Fatal("expecting the permission to be granted", err)
+			}
+		}
+	})
+}
+
+// getUserRolesPerRole is the GetUserRoles implementation fetching the name of
+// each assigned role separately, kept as a baseline
+func getUserRolesPerRole(userID uint) ([]string, error) {
+	var result []string
+	var userRoles []AuthorizationGo.UserRole
+	db.Where("user_id = ?", userID).Find(&userRoles)
+
+	for _, r := range userRoles {
+		var role AuthorizationGo.Role
+		res := db.Where("id = ?", r.RoleID).Find(&role)
+		if res.Error == nil && res.RowsAffected > 0 {
+			result = append(result, role.Name)
+		}
+	}
+
+	return result, nil
+}
+
+// assignPermissionsPerRow is the AssignPermissions implementation looking up
+// and inserting each permission separately, kept as a baseline
+func assignPermissionsPerRow(roleName string, permNames []string) error {
+	var role AuthorizationGo.Role
+	if res := db.Where("name = ?", roleName).First(&role); res.Error != nil {
+		return AuthorizationGo.ErrRoleNotFound
+	}
+
+	var perms []AuthorizationGo.Permission
+	for _, permName := range permNames {
+		var perm AuthorizationGo.Permission
+		if res := db.Where("name = ?", permName).First(&perm); res.Error != nil {
+			return AuthorizationGo.ErrPermissionNotFound
+		}
+		perms = append(perms, perm)
+	}
+
+	for _, perm := range perms {
+		var rolePerm AuthorizationGo.RolePermission
+		res := db.Where("role_id = ?", role.ID).Where("permission_id =?", perm.ID).First(&rolePerm)
+		if res.Error != nil {
+			cRes := db.Create(&AuthorizationGo.RolePermission{RoleID: role.ID, PermissionID: perm.ID})
+			if cRes.Error != nil {
+				return cRes.Error
+			}
+		}
+	}
+
+	return nil
+}
+
+func BenchmarkGetUserRoles(b *testing.B) {
+	auth := setupBenchmark(b, 30, 0)
+
+	b.Run("join", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if roles, _ := auth.GetUserRoles(benchUser); len(roles) != 30 {
+				b.Fatal("expecting 30 roles, got", len(roles))
+			}
+		}
+	})
+
+	b.Run("per-role", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if roles, _ := getUserRolesPerRole(benchUser); len(roles) != 30 {
+				b.Fatal("expecting 30 roles, got", len(roles))
+			}
+		}
+	})
+}
+
+func BenchmarkAssignPermissions(b *testing.B) {
+	auth := setupBenchmark(b, 1, 200)
+	auth.CreateRole("bench-role-bulk")
+
+	var permNames []string
+	for p := 0; p < 200; p++ {
+		permNames = append(permNames, fmt.Sprintf("bench-permission-0-%d", p))
+	}
+
+	var role AuthorizationGo.Role
+	db.Where("name = ?", "bench-role-bulk").First(&role)
+	reset := func(b *testing.B) {
+		b.StopTimer()
+		db.Where("role_id = ?", role.ID).Delete(AuthorizationGo.RolePermission{})
+		b.StartTimer()
+	}
+
+	b.Run("bulk", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			reset(b)
+			if err := auth.AssignPermissions("bench-role-bulk", permNames); err != nil {
+				b.Fatal("unexpected error while assigning permissions.", err)
+			}
+		}
+	})
+
+	b.Run("per-row", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			reset(b)
+			if err := assignPermissionsPerRow("bench-role-bulk", permNames); err != nil {
+				b.Fatal("unexpected error while assigning permissions.", err)
+			}
+		}
+	})
+}
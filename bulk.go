@@ -0,0 +1,293 @@
+package AuthorizationGo
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// AssignRoles assigns the roles to the user in a single transaction, roles
+// already assigned are ignored
+func (a *AuthorizationX) AssignRoles(userID uint, roleNames []string) (err error) {
+	op := a.startSpan("AssignRoles", userAttr(userID), rolesAttr(roleNames))
+	defer op.end(&err)
+
+	var events []Event
+	return a.mutate(&events, func(tx *gorm.DB) error {
+		roles, err := findRoles(tx, roleNames)
+		if err != nil {
+			return err
+		}
+
+		created, err := assignUserRoles(tx, []uint{userID}, roles)
+		events = roleAssignedEvents(created, roles)
+		return err
+	})
+}
+
+// AssignRoleToUsers assigns the role to the users in a single transaction,
+// users already holding the role are ignored
+func (a *AuthorizationX) AssignRoleToUsers(roleName string, userIDs []uint) (err error) {
+	op := a.startSpan("AssignRoleToUsers", roleAttr(roleName))
+	defer op.end(&err)
+
+	var events []Event
+	return a.mutate(&events, func(tx *gorm.DB) error {
+		roles, err := findRoles(tx, []string{roleName})
+		if err != nil {
+			return err
+		}
+
+		created, err := assignUserRoles(tx, userIDs, roles)
+		events = roleAssignedEvents(created, roles)
+		return err
+	})
+}
+
+// RevokeRoles revokes the roles from the user in a single statement, like
+// RevokeRole it fails with ErrRoleRequired when another role of the user
+// requires one of them unless WithDependentRoles is given
+func (a *AuthorizationX) RevokeRoles(userID uint, roleNames []string, opts ...RevokeOption) (err error) {
+	op := a.startSpan("RevokeRoles", userAttr(userID), rolesAttr(roleNames))
+	defer op.end(&err)
+
+	options := newRevokeOptions(opts)
+
+	var events []Event
+	return a.mutate(&events, func(tx *gorm.DB) error {
+		roles, err := findRoles(tx, roleNames)
+		if err != nil {
+			return err
+		}
+		if len(roles) == 0 {
+			return nil
+		}
+
+		revoke := tx.Where("user_id = ?", userID).Where("role_id IN (?)", roleIDs(roles))
+		events, err = roleRevokedEvents(revoke, roles)
+		if err != nil {
+			return err
+		}
+		if err := revoke.Delete(UserRole{}).Error; err != nil {
+			return err
+		}
+
+		dependents, err := revokeDependents(tx, userID, roleIDs(roles), options.dependents)
+		events = append(events, dependents...)
+		return err
+	})
+}
+
+// RevokeRolePermissions revokes the permissions from the role in a single
+// statement
+func (a *AuthorizationX) RevokeRolePermissions(roleName string, permNames []string) (err error) {
+	op := a.startSpan("RevokeRolePermissions", roleAttr(roleName), permissionsAttr(permNames))
+	defer op.end(&err)
+
+	var events []Event
+	return a.mutate(&events, func(tx *gorm.DB) error {
+		// find the role
+		var role Role
+		res := tx.Where("name = ?", roleName).First(&role)
+		if res.Error != nil {
+			if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+				return ErrRoleNotFound
+			}
+			return res.Error
+		}
+
+		perms, err := findPermissions(tx, permNames)
+		if err != nil {
+			return err
+		}
+		if len(perms) == 0 {
+			return nil
+		}
+
+		// find the granted permissions
+		var granted []uint
+		res = tx.Model(&RolePermission{}).Where("role_id = ?", role.ID).Where("permission_id IN (?)", permissionIDs(perms)).Pluck("permission_id", &granted)
+		if res.Error != nil {
+			return res.Error
+		}
+		isGranted := make(map[uint]bool, len(granted))
+		for _, id := range granted {
+			isGranted[id] = true
+		}
+		for _, perm := range perms {
+			if isGranted[perm.ID] {
+				events = append(events, Event{Type: PermissionRevoked, Role: roleName, Permission: perm.Name})
+			}
+		}
+
+		return tx.Where("role_id = ?", role.ID).Where("permission_id IN (?)", permissionIDs(perms)).Delete(RolePermission{}).Error
+	})
+}
+
+// SetUserRoles replaces the roles of the user with the given ones in a single
+// transaction, the given roles must include their prerequisites
+func (a *AuthorizationX) SetUserRoles(userID uint, roleNames []string) (err error) {
+	op := a.startSpan("SetUserRoles", userAttr(userID), rolesAttr(roleNames))
+	defer op.end(&err)
+
+	var events []Event
+	return a.mutate(&events, func(tx *gorm.DB) error {
+		roles, err := findRoles(tx, roleNames)
+		if err != nil {
+			return err
+		}
+
+		// revoke the roles which are not in the list
+		revoke := tx.Where("user_id = ?", userID)
+		if len(roles) > 0 {
+			revoke = revoke.Where("role_id NOT IN (?)", roleIDs(roles))
+		}
+		var revokedRoles []Role
+		res := tx.Where("id IN (?)", revoke.Session(&gorm.Session{}).Model(&UserRole{}).Select("role_id")).Find(&revokedRoles)
+		if res.Error != nil {
+			return res.Error
+		}
+		events, err = roleRevokedEvents(revoke, revokedRoles)
+		if err != nil {
+			return err
+		}
+		if err := revoke.Delete(UserRole{}).Error; err != nil {
+			return err
+		}
+
+		created, err := assignUserRoles(tx, []uint{userID}, roles)
+		events = append(events, roleAssignedEvents(created, roles)...)
+		if err != nil {
+			return err
+		}
+
+		_, err = revokeDependents(tx, userID, roleIDs(revokedRoles), false)
+		return err
+	})
+}
+
+// findRoles returns the roles with the given names, or ErrRoleNotFound when
+// one of them is missing
+func findRoles(tx *gorm.DB, roleNames []string) ([]Role, error) {
+	if len(roleNames) == 0 {
+		return nil, nil
+	}
+
+	var roles []Role
+	res := tx.Where("name IN (?)", roleNames).Find(&roles)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if len(roles) != countUnique(roleNames) {
+		return nil, ErrRoleNotFound
+	}
+
+	return roles, nil
+}
+
+// findPermissions returns the permissions with the given names, or
+// ErrPermissionNotFound when one of them is missing
+func findPermissions(tx *gorm.DB, permNames []string) ([]Permission, error) {
+	if len(permNames) == 0 {
+		return nil, nil
+	}
+
+	var perms []Permission
+	res := tx.Where("name IN (?)", permNames).Find(&perms)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if len(perms) != countUnique(permNames) {
+		return nil, ErrPermissionNotFound
+	}
+
+	return perms, nil
+}
+
+// assignUserRoles assigns every role to every user, existing assignments are
+// skipped and the missing ones are inserted at once. It returns the created
+// assignments.
+func assignUserRoles(tx *gorm.DB, userIDs []uint, roles []Role) ([]UserRole, error) {
+	if len(userIDs) == 0 || len(roles) == 0 {
+		return nil, nil
+	}
+
+	// find the existing assignments
+	var existing []UserRole
+	res := tx.Where("user_id IN (?)", userIDs).Where("role_id IN (?)", roleIDs(roles)).Find(&existing)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	assigned := make(map[UserRole]bool, len(existing))
+	for _, ur := range existing {
+		assigned[UserRole{UserID: ur.UserID, RoleID: ur.RoleID}] = true
+	}
+
+	var userRoles []UserRole
+	for _, userID := range userIDs {
+		for _, role := range roles {
+			ur := UserRole{UserID: userID, RoleID: role.ID}
+			if !assigned[ur] {
+				// skip duplicated user ids too
+				assigned[ur] = true
+				userRoles = append(userRoles, ur)
+			}
+		}
+	}
+	if len(userRoles) == 0 {
+		return nil, nil
+	}
+	if err := checkRoleConflicts(tx, userIDs, roleIDs(roles), 0); err != nil {
+		return nil, err
+	}
+	if err := checkAssignmentLimits(tx, userRoles, 0); err != nil {
+		return nil, err
+	}
+	if err := checkPrerequisites(tx, userIDs, roleIDs(roles), 0); err != nil {
+		return nil, err
+	}
+
+	return userRoles, tx.CreateInBatches(userRoles, insertBatchSize).Error
+}
+
+func roleIDs(roles []Role) []uint {
+	ids := make([]uint, len(roles))
+	for i, role := range roles {
+		ids[i] = role.ID
+	}
+
+	return ids
+}
+
+func permissionIDs(perms []Permission) []uint {
+	ids := make([]uint, len(perms))
+	for i, perm := range perms {
+		ids[i] = perm.ID
+	}
+
+	return ids
+}
+
+// roleRevokedEvents returns the events of the assignments of the roles matched
+// by the query, which is expected to be scoped to the user_roles table
+func roleRevokedEvents(query *gorm.DB, roles []Role) ([]Event, error) {
+	var userRoles []UserRole
+	res := query.Session(&gorm.Session{}).Find(&userRoles)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	names := make(map[uint]string, len(roles))
+	for _, role := range roles {
+		names[role.ID] = role.Name
+	}
+
+	var events []Event
+	for _, ur := range userRoles {
+		if name, ok := names[ur.RoleID]; ok {
+			events = append(events, Event{Type: RoleRevoked, Role: name, UserID: ur.UserID})
+		}
+	}
+
+	return events, nil
+}
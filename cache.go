@@ -0,0 +1,302 @@
+package AuthorizationGo
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Invalidation tells the instances sharing a database which cached decisions
+// are stale, the ones of some users or all of them
+type Invalidation struct {
+	UserIDs []uint `json:"user_ids,omitempty"`
+	All     bool   `json:"all,omitempty"`
+}
+
+// maxInvalidationUsers is the number of users above which an invalidation
+// drops every decision, the transports limiting the size of a message fall
+// back to All on their own
+const maxInvalidationUsers = 500
+
+// merge returns the decisions stale after both invalidations
+func (inv Invalidation) merge(other Invalidation) Invalidation {
+	if inv.All || other.All {
+		return Invalidation{All: true}
+	}
+
+	seen := make(map[uint]bool, len(inv.UserIDs))
+	merged := Invalidation{UserIDs: append([]uint{}, inv.UserIDs...)}
+	for _, id := range inv.UserIDs {
+		seen[id] = true
+	}
+	for _, id := range other.UserIDs {
+		if !seen[id] {
+			seen[id] = true
+			merged.UserIDs = append(merged.UserIDs, id)
+		}
+	}
+	if len(merged.UserIDs) > maxInvalidationUsers {
+		return Invalidation{All: true}
+	}
+
+	return merged
+}
+
+// InvalidationTransport carries invalidations between the instances sharing a
+// database. Publish reaches every listener, including the publishing
+// instance.
+type InvalidationTransport interface {
+	Publish(ctx context.Context, inv Invalidation) error
+	// Listen calls fn with the invalidations until ctx is done. When
+	// invalidations may have been missed, after a reconnection for
+	// example, fn is called with All set.
+	Listen(ctx context.Context, fn func(Invalidation)) error
+}
+
+// CacheOptions controls the decision cache, zero values use the defaults
+type CacheOptions struct {
+	// TTL is how long a decision is cached, 1 minute by default
+	TTL time.Duration
+	// MaxUsers is the number of users cached before the cache is cleared,
+	// 10000 by default
+	MaxUsers int
+	// Transport shares the invalidations with the other instances, without
+	// it only the changes made through this instance invalidate the cache
+	Transport InvalidationTransport
+	// OnError is called with the errors of the transport
+	OnError func(error)
+}
+
+// EnableCache caches the results of CheckPermission and CheckRole. Changes
+// made through a invalidate the cache once committed, with a single
+// invalidation per mutation. They are published to the transport in the
+// background, the invalidations waiting to be published being merged, and the
+// invalidations received from it are applied until ctx is done. It must be
+// called before a is used concurrently.
+func (a *AuthorizationX) EnableCache(ctx context.Context, opts CacheOptions) {
+	if opts.TTL <= 0 {
+		opts.TTL = time.Minute
+	}
+	if opts.MaxUsers <= 0 {
+		opts.MaxUsers = 10000
+	}
+
+	cache := newDecisionCache(opts.TTL, opts.MaxUsers)
+	a.cache = cache
+
+	var queue *invalidationQueue
+	if opts.Transport != nil {
+		queue = newInvalidationQueue()
+		go queue.run(ctx, opts.Transport, opts.OnError)
+	}
+
+	bus := a.bus()
+	bus.mu.Lock()
+	bus.batchHooks = append(bus.batchHooks, func(events []Event) {
+		inv, ok := invalidationOf(events)
+		if !ok {
+			return
+		}
+
+		cache.invalidate(inv)
+		if queue != nil {
+			queue.push(inv)
+		}
+	})
+	bus.mu.Unlock()
+
+	if opts.Transport != nil {
+		go func() {
+			err := opts.Transport.Listen(ctx, cache.invalidate)
+			if err != nil && ctx.Err() == nil && opts.OnError != nil {
+				opts.OnError(err)
+			}
+		}()
+	}
+}
+
+// invalidationOf returns the decisions made stale by the events of a
+// mutation, creations do not change any decision
+func invalidationOf(events []Event) (Invalidation, bool) {
+	var inv Invalidation
+	for _, e := range events {
+		switch e.Type {
+		case RoleCreated, PermissionCreated:
+		case RoleAssigned, RoleRevoked:
+			inv = inv.merge(Invalidation{UserIDs: []uint{e.UserID}})
+		default:
+			return Invalidation{All: true}, true
+		}
+	}
+
+	return inv, inv.All || len(inv.UserIDs) > 0
+}
+
+// invalidationQueue publishes the invalidations in the background so the
+// mutations do not wait for the transport, the invalidations pushed while one
+// is being published are merged into the next one
+type invalidationQueue struct {
+	mu      sync.Mutex
+	pending *Invalidation
+	wake    chan struct{}
+}
+
+func newInvalidationQueue() *invalidationQueue {
+	return &invalidationQueue{wake: make(chan struct{}, 1)}
+}
+
+func (q *invalidationQueue) push(inv Invalidation) {
+	q.mu.Lock()
+	if q.pending != nil {
+		inv = q.pending.merge(inv)
+	}
+	q.pending = &inv
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run publishes the pending invalidation until ctx is done
+func (q *invalidationQueue) run(ctx context.Context, transport InvalidationTransport, onError func(error)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		}
+
+		q.mu.Lock()
+		inv := q.pending
+		q.pending = nil
+		q.mu.Unlock()
+		if inv == nil {
+			continue
+		}
+
+		if err := transport.Publish(ctx, *inv); err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
+
+// verdict is the result of a check, role is the role granting it
+type verdict struct {
+	allowed bool
+	role    string
+}
+
+// cached returns the cached verdict when the cache is enabled, or the one of
+// resolve
+func (a *AuthorizationX) cached(userID uint, key string, resolve func() (verdict, error)) (verdict, CacheStatus, error) {
+	if a.cache == nil {
+		v, err := resolve()
+		return v, CacheDisabled, err
+	}
+
+	return a.cache.check(userID, key, resolve)
+}
+
+type cacheEntry struct {
+	verdict verdict
+	expires time.Time
+}
+
+// decisionCache holds the decisions by user, a generation counter keeps a
+// decision computed before an invalidation from being stored after it
+type decisionCache struct {
+	ttl      time.Duration
+	maxUsers int
+
+	mu         sync.Mutex
+	generation uint64
+	users      map[uint]map[string]cacheEntry
+}
+
+func newDecisionCache(ttl time.Duration, maxUsers int) *decisionCache {
+	return &decisionCache{ttl: ttl, maxUsers: maxUsers, users: map[uint]map[string]cacheEntry{}}
+}
+
+// check returns the cached decision or the one of resolve, errors are not
+// cached
+func (c *decisionCache) check(userID uint, key string, resolve func() (verdict, error)) (verdict, CacheStatus, error) {
+	c.mu.Lock()
+	entry, found := c.users[userID][key]
+	generation := c.generation
+	c.mu.Unlock()
+	if found && time.Now().Before(entry.expires) {
+		return entry.verdict, CacheHit, nil
+	}
+
+	v, err := resolve()
+	if err != nil {
+		return verdict{}, CacheMiss, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation != generation {
+		return v, CacheMiss, nil
+	}
+	entries := c.users[userID]
+	if entries == nil {
+		if len(c.users) >= c.maxUsers {
+			c.users = map[uint]map[string]cacheEntry{}
+		}
+		entries = map[string]cacheEntry{}
+		c.users[userID] = entries
+	}
+	entries[key] = cacheEntry{verdict: v, expires: time.Now().Add(c.ttl)}
+
+	return v, CacheMiss, nil
+}
+
+func (c *decisionCache) invalidate(inv Invalidation) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	if inv.All {
+		c.users = map[uint]map[string]cacheEntry{}
+		return
+	}
+	for _, id := range inv.UserIDs {
+		delete(c.users, id)
+	}
+}
+
+// NewMemoryTransport returns a transport delivering the invalidations to the
+// listeners of the same process, to share a cache between instances in tests
+func NewMemoryTransport() InvalidationTransport {
+	return &memoryTransport{listeners: map[*func(Invalidation)]struct{}{}}
+}
+
+type memoryTransport struct {
+	mu        sync.RWMutex
+	listeners map[*func(Invalidation)]struct{}
+}
+
+func (m *memoryTransport) Publish(ctx context.Context, inv Invalidation) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for fn := range m.listeners {
+		(*fn)(inv)
+	}
+	return nil
+}
+
+func (m *memoryTransport) Listen(ctx context.Context, fn func(Invalidation)) error {
+	m.mu.Lock()
+	m.listeners[&fn] = struct{}{}
+	m.mu.Unlock()
+
+	<-ctx.Done()
+
+	m.mu.Lock()
+	delete(m.listeners, &fn)
+	m.mu.Unlock()
+	return ctx.Err()
+}
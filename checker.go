@@ -0,0 +1,54 @@
+package AuthorizationGo
+
+import "context"
+
+// Checker is the part of AuthorizationX needed to guard requests, the
+// middleware adapters accept it so they can be used with any implementation
+type Checker interface {
+	CheckPermission(userID uint, permName string) (bool, error)
+	CheckRole(userID uint, roleName string) (bool, error)
+}
+
+// ContextChecker is a Checker able to run its checks with the context of a
+// request, so their spans are children of the span of the request
+type ContextChecker interface {
+	Checker
+	CheckPermissionContext(ctx context.Context, userID uint, permName string) (bool, error)
+	CheckRoleContext(ctx context.Context, userID uint, roleName string) (bool, error)
+}
+
+var _ ContextChecker = (*AuthorizationX)(nil)
+
+// CheckPermissionContext is CheckPermission with the spans and queries of ctx
+func (a *AuthorizationX) CheckPermissionContext(ctx context.Context, userID uint, permName string) (bool, error) {
+	return a.WithContext(ctx).CheckPermission(userID, permName)
+}
+
+// CheckRoleContext is CheckRole with the spans and queries of ctx
+func (a *AuthorizationX) CheckRoleContext(ctx context.Context, userID uint, roleName string) (bool, error) {
+	return a.WithContext(ctx).CheckRole(userID, roleName)
+}
+
+// CheckerWithContext returns a Checker running the checks of c with ctx when
+// c is a ContextChecker, or c itself. The middleware adapters call it with the
+// context of each request.
+func CheckerWithContext(ctx context.Context, c Checker) Checker {
+	if cc, ok := c.(ContextChecker); ok {
+		return boundChecker{ctx: ctx, checker: cc}
+	}
+
+	return c
+}
+
+type boundChecker struct {
+	ctx     context.Context
+	checker ContextChecker
+}
+
+func (b boundChecker) CheckPermission(userID uint, permName string) (bool, error) {
+	return b.checker.CheckPermissionContext(b.ctx, userID, permName)
+}
+
+func (b boundChecker) CheckRole(userID uint, roleName string) (bool, error) {
+	return b.checker.CheckRoleContext(b.ctx, userID, roleName)
+}
@@ -0,0 +1,416 @@
+// Command authzctl operates the AuthorizationGo tables through the library so
+// its invariants are kept.
+//
+// Usage:
+//
+//	authzctl [-driver postgres|mysql|sqlite] [-dsn DSN] [-prefix PREFIX] COMMAND [ARGS]
+//
+// The DSN defaults to the AUTHZ_DSN environment variable. Run authzctl -h for
+// the list of commands.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	AuthorizationGo "github.com/SoegiDev/AuthorizationGo"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var errUsage = errors.New("invalid arguments")
+
+type command struct {
+	args  string
+	help  string
+	nargs int
+	run   func(auth *AuthorizationGo.AuthorizationX, fs *flag.FlagSet, args []string) error
+}
+
+var commands = map[string]command{
+	"create-role": {"ROLE", "create a role", 1, func(auth *AuthorizationGo.AuthorizationX, _ *flag.FlagSet, args []string) error {
+		return auth.CreateRole(args[0])
+	}},
+	"rename-role": {"ROLE NEW_NAME", "rename a role", 2, func(auth *AuthorizationGo.AuthorizationX, _ *flag.FlagSet, args []string) error {
+		return auth.RenameRole(args[0], args[1])
+	}},
+	"delete-role": {"[DELETE FLAGS] ROLE", "delete a role", 1, func(auth *AuthorizationGo.AuthorizationX, fs *flag.FlagSet, args []string) error {
+		n, err := auth.DeleteRoleCount(args[0], deleteOptions(fs)...)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d assignments affected\n", n)
+		return nil
+	}},
+	"restore-role": {"ROLE", "restore a deleted role", 1, func(auth *AuthorizationGo.AuthorizationX, _ *flag.FlagSet, args []string) error {
+		return auth.RestoreRole(args[0])
+	}},
+	"create-permission": {"PERMISSION", "create a permission", 1, func(auth *AuthorizationGo.AuthorizationX, _ *flag.FlagSet, args []string) error {
+		return auth.CreatePermission(args[0])
+	}},
+	"rename-permission": {"PERMISSION NEW_NAME", "rename a permission", 2, func(auth *AuthorizationGo.AuthorizationX, _ *flag.FlagSet, args []string) error {
+		return auth.RenamePermission(args[0], args[1])
+	}},
+	"delete-permission": {"[DELETE FLAGS] PERMISSION", "delete a permission", 1, func(auth *AuthorizationGo.AuthorizationX, fs *flag.FlagSet, args []string) error {
+		n, err := auth.DeletePermissionCount(args[0], deleteOptions(fs)...)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d grants affected\n", n)
+		return nil
+	}},
+	"restore-permission": {"PERMISSION", "restore a deleted permission", 1, func(auth *AuthorizationGo.AuthorizationX, _ *flag.FlagSet, args []string) error {
+		return auth.RestorePermission(args[0])
+	}},
+	"grant": {"ROLE PERMISSION...", "grant permissions to a role", 2, func(auth *AuthorizationGo.AuthorizationX, _ *flag.FlagSet, args []string) error {
+		return auth.AssignPermissions(args[0], args[1:])
+	}},
+	"ungrant": {"ROLE PERMISSION", "revoke a permission from a role", 2, func(auth *AuthorizationGo.AuthorizationX, _ *flag.FlagSet, args []string) error {
+		return auth.RevokeRolePermission(args[0], args[1])
+	}},
+	"assign": {"USER ROLE", "assign a role to a user", 2, func(auth *AuthorizationGo.AuthorizationX, _ *flag.FlagSet, args []string) error {
+		userID, err := parseUserID(args[0])
+		if err != nil {
+			return err
+		}
+		return auth.AssignRole(userID, args[1])
+	}},
+	"revoke": {"[-dependents] USER ROLE", "revoke a role from a user", 2, func(auth *AuthorizationGo.AuthorizationX, fs *flag.FlagSet, args []string) error {
+		userID, err := parseUserID(args[0])
+		if err != nil {
+			return err
+		}
+		var opts []AuthorizationGo.RevokeOption
+		if isSet(fs, "dependents") {
+			opts = append(opts, AuthorizationGo.WithDependentRoles())
+		}
+		return auth.RevokeRole(userID, args[1], opts...)
+	}},
+	"check": {"USER PERMISSION", "check a permission of a user", 2, func(auth *AuthorizationGo.AuthorizationX, _ *flag.FlagSet, args []string) error {
+		userID, err := parseUserID(args[0])
+		if err != nil {
+			return err
+		}
+		return printCheck(auth.CheckPermission(userID, args[1]))
+	}},
+	"check-role": {"USER ROLE", "check a role of a user", 2, func(auth *AuthorizationGo.AuthorizationX, _ *flag.FlagSet, args []string) error {
+		userID, err := parseUserID(args[0])
+		if err != nil {
+			return err
+		}
+		return printCheck(auth.CheckRole(userID, args[1]))
+	}},
+	"check-grant": {"ROLE PERMISSION", "check a permission of a role", 2, func(auth *AuthorizationGo.AuthorizationX, _ *flag.FlagSet, args []string) error {
+		return printCheck(auth.CheckRolePermission(args[0], args[1]))
+	}},
+	"roles": {"[USER]", "list the roles, or the roles of a user", 0, func(auth *AuthorizationGo.AuthorizationX, _ *flag.FlagSet, args []string) error {
+		if len(args) == 0 {
+			return printList(auth.ListRoles(AuthorizationGo.ListOptions{}))
+		}
+		userID, err := parseUserID(args[0])
+		if err != nil {
+			return err
+		}
+		return printList(auth.ListUserRoles(userID, AuthorizationGo.ListOptions{}))
+	}},
+	"permissions": {"", "list the permissions", 0, func(auth *AuthorizationGo.AuthorizationX, _ *flag.FlagSet, args []string) error {
+		return printList(auth.ListPermissions(AuthorizationGo.ListOptions{}))
+	}},
+	"role-users": {"ROLE", "list the users assigned a role", 1, func(auth *AuthorizationGo.AuthorizationX, _ *flag.FlagSet, args []string) error {
+		return printList(auth.ListUsersWithRole(args[0], AuthorizationGo.ListOptions{}))
+	}},
+	"permission-roles": {"PERMISSION", "list the roles granted a permission", 1, func(auth *AuthorizationGo.AuthorizationX, _ *flag.FlagSet, args []string) error {
+		return printList(auth.ListRolesWithPermission(args[0], AuthorizationGo.ListOptions{}))
+	}},
+	"permission-users": {"PERMISSION", "list the users granted a permission", 1, func(auth *AuthorizationGo.AuthorizationX, _ *flag.FlagSet, args []string) error {
+		return printList(auth.GetUsersWithPermission(args[0], AuthorizationGo.ListOptions{}))
+	}},
+	"export": {"[FILE]", "export the policy as JSON, to stdout by default", 0, func(auth *AuthorizationGo.AuthorizationX, _ *flag.FlagSet, args []string) error {
+		policy, err := auth.ExportPolicy()
+		if err != nil {
+			return err
+		}
+
+		out := os.Stdout
+		if len(args) > 0 {
+			if out, err = os.Create(args[0]); err != nil {
+				return err
+			}
+			defer out.Close()
+		}
+
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(policy)
+	}},
+	"snapshot": {"[FILE]", "export all the rows as JSON, to stdout by default", 0, func(auth *AuthorizationGo.AuthorizationX, _ *flag.FlagSet, args []string) error {
+		snapshot, err := auth.Snapshot()
+		if err != nil {
+			return err
+		}
+
+		out := os.Stdout
+		if len(args) > 0 {
+			if out, err = os.Create(args[0]); err != nil {
+				return err
+			}
+			defer out.Close()
+		}
+
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(snapshot)
+	}},
+	"diff": {"[-json] FROM [TO]", "compare two snapshots, TO defaults to the current rows", 1, func(auth *AuthorizationGo.AuthorizationX, fs *flag.FlagSet, args []string) error {
+		from, err := readSnapshot(args[0])
+		if err != nil {
+			return err
+		}
+		var to *AuthorizationGo.Snapshot
+		if len(args) > 1 {
+			to, err = readSnapshot(args[1])
+		} else {
+			to, err = auth.Snapshot()
+		}
+		if err != nil {
+			return err
+		}
+
+		diff := AuthorizationGo.Diff(from, to)
+		if isSet(fs, "json") {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(diff)
+		}
+		fmt.Print(diff)
+		return nil
+	}},
+	"import": {"[FILE]", "import a JSON policy, from stdin by default", 0, func(auth *AuthorizationGo.AuthorizationX, _ *flag.FlagSet, args []string) error {
+		policy, err := readPolicy(args)
+		if err != nil {
+			return err
+		}
+		return auth.ImportPolicy(policy)
+	}},
+	"plan": {"[-prune] [FILE]", "show the changes converging to a JSON policy", 0, func(auth *AuthorizationGo.AuthorizationX, fs *flag.FlagSet, args []string) error {
+		return reconcile(auth, fs, args, false)
+	}},
+	"apply": {"[-prune] [FILE]", "converge to a JSON policy and show the changes", 0, func(auth *AuthorizationGo.AuthorizationX, fs *flag.FlagSet, args []string) error {
+		return reconcile(auth, fs, args, true)
+	}},
+}
+
+func main() {
+	driver := flag.String("driver", "postgres", "database `driver`: postgres, mysql or sqlite")
+	dsn := flag.String("dsn", os.Getenv("AUTHZ_DSN"), "database connection string")
+	prefix := flag.String("prefix", "", "prefix of the authorization tables")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	name := flag.Arg(0)
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "authzctl: unknown command %q\n", name)
+		usage()
+		os.Exit(2)
+	}
+
+	fs := newFlagSet(name, flag.ExitOnError)
+	fs.Parse(flag.Args()[1:])
+	if fs.NArg() < cmd.nargs {
+		fmt.Fprintf(os.Stderr, "usage: authzctl %s %s\n", name, cmd.args)
+		os.Exit(2)
+	}
+
+	if *dsn == "" {
+		fatal(errors.New("missing -dsn or AUTHZ_DSN"))
+	}
+	var dialector gorm.Dialector
+	switch *driver {
+	case "postgres":
+		dialector = postgres.Open(*dsn)
+	case "mysql":
+		dialector = mysql.Open(*dsn)
+	case "sqlite":
+		dialector = sqlite.Open(*dsn)
+	default:
+		fatal(fmt.Errorf("unknown driver %q", *driver))
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		fatal(err)
+	}
+
+	auth := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: *prefix,
+		DB:           db,
+	})
+
+	if err := cmd.run(auth, fs, fs.Args()); err != nil {
+		fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: authzctl [-driver DRIVER] [-dsn DSN] [-prefix PREFIX] COMMAND [ARGS]\n\nFlags:\n")
+	flag.PrintDefaults()
+	fmt.Fprintf(os.Stderr, "\nCommands:\n")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(os.Stderr, 0, 4, 2, ' ', 0)
+	for _, name := range names {
+		cmd := commands[name]
+		fmt.Fprintf(w, "  %s %s\t%s\n", name, cmd.args, cmd.help)
+	}
+	w.Flush()
+	fmt.Fprintf(os.Stderr, "\nDelete flags: -cascade, -force, -purge, -reassign-to NAME\n")
+}
+
+// newFlagSet declares the flags of the command name
+func newFlagSet(name string, errorHandling flag.ErrorHandling) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, errorHandling)
+	if strings.HasPrefix(name, "delete-") {
+		fs.Bool("cascade", false, "remove the assignments referencing it")
+		fs.Bool("force", false, "delete it even when assigned, keeping the assignments")
+		fs.Bool("purge", false, "delete it permanently")
+		fs.String("reassign-to", "", "move the assignments referencing it to `NAME`")
+	}
+	if name == "plan" || name == "apply" {
+		fs.Bool("prune", false, "delete the entries missing from the policy")
+	}
+	if name == "diff" {
+		fs.Bool("json", false, "print the diff as JSON")
+	}
+	if name == "revoke" {
+		fs.Bool("dependents", false, "also revoke the roles requiring it")
+	}
+	return fs
+}
+
+// isSet reports whether the boolean flag name is true, -name=false turns it
+// off like leaving it out
+func isSet(fs *flag.FlagSet, name string) bool {
+	return fs.Lookup(name).Value.String() == "true"
+}
+
+func deleteOptions(fs *flag.FlagSet) []AuthorizationGo.DeleteOption {
+	var opts []AuthorizationGo.DeleteOption
+	if isSet(fs, "cascade") {
+		opts = append(opts, AuthorizationGo.WithCascade())
+	}
+	if isSet(fs, "force") {
+		opts = append(opts, AuthorizationGo.WithForce())
+	}
+	if isSet(fs, "purge") {
+		opts = append(opts, AuthorizationGo.WithPurge())
+	}
+	if name := fs.Lookup("reassign-to").Value.String(); name != "" {
+		opts = append(opts, AuthorizationGo.WithReassignTo(name))
+	}
+	return opts
+}
+
+// readPolicy decodes the JSON policy of the file in args, or of stdin
+func readPolicy(args []string) (*AuthorizationGo.Policy, error) {
+	var in io.Reader = os.Stdin
+	if len(args) > 0 {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	var policy AuthorizationGo.Policy
+	if err := json.NewDecoder(in).Decode(&policy); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// readSnapshot decodes the JSON snapshot of the file
+func readSnapshot(name string) (*AuthorizationGo.Snapshot, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var snapshot AuthorizationGo.Snapshot
+	if err := json.NewDecoder(f).Decode(&snapshot); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+func reconcile(auth *AuthorizationGo.AuthorizationX, fs *flag.FlagSet, args []string, apply bool) error {
+	policy, err := readPolicy(args)
+	if err != nil {
+		return err
+	}
+
+	opts := AuthorizationGo.ReconcileOptions{Apply: apply, Prune: isSet(fs, "prune")}
+
+	plan, err := auth.Reconcile(*policy, opts)
+	if err != nil {
+		return err
+	}
+	fmt.Print(plan)
+	return nil
+}
+
+func parseUserID(s string) (uint, error) {
+	userID, err := strconv.ParseUint(s, 10, 0)
+	if err != nil {
+		return 0, fmt.Errorf("%w: bad user id %q", errUsage, s)
+	}
+	return uint(userID), nil
+}
+
+func printCheck(ok bool, err error) error {
+	if err != nil {
+		return err
+	}
+	if ok {
+		fmt.Println("allowed")
+	} else {
+		fmt.Println("denied")
+	}
+	return nil
+}
+
+func printList[T any](items []T, err error) error {
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		fmt.Println(item)
+	}
+	return nil
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "authzctl:", err)
+	os.Exit(1)
+}
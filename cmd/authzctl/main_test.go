@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	AuthorizationGo "github.com/SoegiDev/AuthorizationGo"
+	"github.com/SoegiDev/AuthorizationGo/internal/testdb"
+	"gorm.io/gorm"
+)
+
+var db *gorm.DB
+
+var prefix_test string = "authGo_ctl_"
+
+func TestMain(m *testing.M) {
+	var err error
+	db, err = testdb.Open("authzctl")
+	if err != nil {
+		log.Fatal("Error opening the test database: ", err)
+	}
+
+	os.Exit(m.Run())
+}
+
+func setup(t *testing.T) *AuthorizationGo.AuthorizationX {
+	auth := AuthorizationGo.New(AuthorizationGo.AuthOption{
+		TablesPrefix: prefix_test,
+		DB:           db,
+	})
+
+	t.Cleanup(func() {
+		db.Where("1 = 1").Delete(AuthorizationGo.UserRole{})
+		db.Where("1 = 1").Delete(AuthorizationGo.RolePermission{})
+		db.Unscoped().Where("1 = 1").Delete(&AuthorizationGo.Role{})
+		db.Unscoped().Where("1 = 1").Delete(&AuthorizationGo.Permission{})
+	})
+
+	return auth
+}
+
+// run parses args like main does and runs the command, returning what it
+// printed
+func run(t *testing.T, auth *AuthorizationGo.AuthorizationX, args ...string) (string, error) {
+	t.Helper()
+
+	cmd := commands[args[0]]
+	fs := newFlagSet(args[0], flag.ContinueOnError)
+	if err := fs.Parse(args[1:]); err != nil {
+		t.Fatal(err)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	err = cmd.run(auth, fs, fs.Args())
+	os.Stdout = stdout
+	w.Close()
+
+	out, _ := io.ReadAll(r)
+	return string(out), err
+}
+
+func TestDeleteFlags(t *testing.T) {
+	auth := setup(t)
+
+	auth.CreateRole("admin")
+	auth.CreateRole("other")
+	auth.AssignRole(1, "other")
+
+	for _, args := range [][]string{
+		{"delete-role", "-cascade=false", "other"},
+		{"delete-role", "-force=false", "other"},
+		{"delete-role", "-reassign-to=", "other"},
+	} {
+		if _, err := run(t, auth, args...); !errors.Is(err, AuthorizationGo.ErrRoleInUse) {
+			t.Errorf("%v: got %v, want ErrRoleInUse", args, err)
+		}
+	}
+	if ok, _ := auth.CheckRole(1, "other"); !ok {
+		t.Fatal("the role was deleted with the flags turned off")
+	}
+
+	if _, err := run(t, auth, "delete-role", "-purge=false", "-force", "other"); err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.RestoreRole("other"); err != nil {
+		t.Fatalf("the role was purged with -purge=false: %v", err)
+	}
+
+	out, err := run(t, auth, "delete-role", "-cascade=true", "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "1 assignments affected\n" {
+		t.Errorf("got %q", out)
+	}
+}
+
+func TestReconcileFlags(t *testing.T) {
+	auth := setup(t)
+
+	auth.CreateRole("admin")
+	auth.CreateRole("other")
+	auth.AssignRole(1, "other")
+
+	file := filepath.Join(t.TempDir(), "policy.json")
+	data, _ := json.Marshal(AuthorizationGo.Policy{
+		Roles: []AuthorizationGo.RolePolicy{{Name: "admin"}},
+	})
+	if err := os.WriteFile(file, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"plan", "apply"} {
+		out, err := run(t, auth, name, "-prune=false", file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(out, "other") {
+			t.Errorf("%s -prune=false pruned:\n%s", name, out)
+		}
+	}
+	if ok, _ := auth.CheckRole(1, "other"); !ok {
+		t.Fatal("apply -prune=false revoked the role")
+	}
+
+	out, err := run(t, auth, "plan", "-prune", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "other") {
+		t.Errorf("plan -prune did not prune:\n%s", out)
+	}
+}
@@ -0,0 +1,61 @@
+package AuthorizationGo
+
+import "time"
+
+// CheckKind is the method which made a decision
+type CheckKind string
+
+const (
+	PermissionCheck     CheckKind = "permission"
+	RoleCheck           CheckKind = "role"
+	RolePermissionCheck CheckKind = "role_permission"
+	SessionCheck        CheckKind = "session"
+)
+
+// CacheStatus tells whether a decision came from the decision cache
+type CacheStatus int
+
+const (
+	CacheDisabled CacheStatus = iota
+	CacheHit
+	CacheMiss
+)
+
+// Decision is the outcome of CheckPermission, CheckRole, CheckRolePermission
+// or Session.CheckPermission. UserID is not set for CheckRolePermission and
+// Role is not set for the permission checks. MatchedRole is the role granting
+// an allowed decision, the first by name when several do.
+type Decision struct {
+	Check       CheckKind
+	UserID      uint
+	Role        string
+	Permission  string
+	Allowed     bool
+	MatchedRole string
+	Err         error
+	Cache       CacheStatus
+	Duration    time.Duration
+}
+
+// OnDecision registers a hook called synchronously with every decision, it
+// runs on the goroutine of the check and should not block
+func (a *AuthorizationX) OnDecision(hook func(Decision)) {
+	bus := a.bus()
+
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	bus.decisionHooks = append(bus.decisionHooks, hook)
+}
+
+// observe calls the decision hooks
+func (a *AuthorizationX) observe(d Decision) {
+	bus := a.bus()
+
+	bus.mu.RLock()
+	hooks := bus.decisionHooks
+	bus.mu.RUnlock()
+
+	for _, hook := range hooks {
+		hook(d)
+	}
+}
@@ -0,0 +1,54 @@
+package AuthorizationGo
+
+// DeleteOption changes the behaviour of DeleteRole and DeletePermission
+type DeleteOption func(*deleteOptions)
+
+type deleteOptions struct {
+	cascade    bool
+	force      bool
+	purge      bool
+	reassignTo string
+}
+
+// WithCascade removes the assignments referencing the deleted role or
+// permission instead of refusing the delete, the roles of the users requiring
+// the deleted role are revoked too
+func WithCascade() DeleteOption {
+	return func(o *deleteOptions) {
+		o.cascade = true
+	}
+}
+
+// WithReassignTo moves the assignments referencing the deleted role or
+// permission to the given role or permission. A role cannot be reassigned
+// while its holders have roles requiring it, it fails with ErrRoleRequired.
+func WithReassignTo(name string) DeleteOption {
+	return func(o *deleteOptions) {
+		o.reassignTo = name
+	}
+}
+
+// WithForce deletes the role or permission even when it is still assigned,
+// the assignments are kept but stop granting access until it is restored
+func WithForce() DeleteOption {
+	return func(o *deleteOptions) {
+		o.force = true
+	}
+}
+
+// WithPurge deletes the role or permission permanently along with its
+// remaining assignments, it cannot be restored afterwards
+func WithPurge() DeleteOption {
+	return func(o *deleteOptions) {
+		o.purge = true
+	}
+}
+
+func newDeleteOptions(opts []DeleteOption) deleteOptions {
+	var options deleteOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return options
+}
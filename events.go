@@ -0,0 +1,257 @@
+package AuthorizationGo
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// EventType is the kind of change an Event reports
+type EventType string
+
+const (
+	RoleCreated        EventType = "role.created"
+	RoleRenamed        EventType = "role.renamed"
+	RoleDeleted        EventType = "role.deleted"
+	RoleRestored       EventType = "role.restored"
+	PermissionCreated  EventType = "permission.created"
+	PermissionRenamed  EventType = "permission.renamed"
+	PermissionDeleted  EventType = "permission.deleted"
+	PermissionRestored EventType = "permission.restored"
+	// PermissionGranted and PermissionRevoked report the grants of a role
+	PermissionGranted EventType = "permission.granted"
+	PermissionRevoked EventType = "permission.revoked"
+	// RoleAssigned and RoleRevoked report the assignments of a user
+	RoleAssigned EventType = "role.assigned"
+	RoleRevoked  EventType = "role.revoked"
+)
+
+// Event is a change made by a successful mutation. Role and Permission hold the
+// names involved, UserID is set for assignments and NewName for renames.
+type Event struct {
+	Type       EventType `json:"type"`
+	Role       string    `json:"role,omitempty"`
+	Permission string    `json:"permission,omitempty"`
+	UserID     uint      `json:"user_id,omitempty"`
+	NewName    string    `json:"new_name,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+// OnEvent registers a hook called synchronously with every event once the
+// mutation is committed, in the order the hooks are registered. Hooks run on
+// the goroutine of the mutation and should not block.
+func (a *AuthorizationX) OnEvent(hook func(Event)) {
+	bus := a.bus()
+
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	bus.hooks = append(bus.hooks, hook)
+}
+
+// Subscribe returns a channel receiving every event once the mutation is
+// committed and a function closing it. Events are queued so mutations never
+// wait for the subscriber.
+func (a *AuthorizationX) Subscribe() (<-chan Event, func()) {
+	bus := a.bus()
+	sub := &subscription{ch: make(chan Event)}
+	sub.cond = sync.NewCond(&sub.mu)
+
+	bus.mu.Lock()
+	bus.subs[sub] = struct{}{}
+	bus.mu.Unlock()
+
+	go sub.run()
+
+	var once sync.Once
+	return sub.ch, func() {
+		once.Do(func() {
+			bus.mu.Lock()
+			delete(bus.subs, sub)
+			bus.mu.Unlock()
+
+			sub.mu.Lock()
+			sub.closed = true
+			sub.cond.Signal()
+			sub.mu.Unlock()
+
+			// drain the channel so run can exit
+			for range sub.ch {
+			}
+		})
+	}
+}
+
+type eventBus struct {
+	mu    sync.RWMutex
+	hooks []func(Event)
+	subs  map[*subscription]struct{}
+	// batchHooks are called once per mutation with all its events, before
+	// the hooks
+	batchHooks []func([]Event)
+
+	decisionHooks []func(Decision)
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{subs: map[*subscription]struct{}{}}
+}
+
+func (b *eventBus) emit(events []Event) {
+	// copy the hooks and subscribers so a hook can register another one
+	b.mu.RLock()
+	batchHooks := b.batchHooks
+	hooks := b.hooks
+	subs := make([]*subscription, 0, len(b.subs))
+	for sub := range b.subs {
+		subs = append(subs, sub)
+	}
+	b.mu.RUnlock()
+
+	for _, hook := range batchHooks {
+		hook(events)
+	}
+	for _, e := range events {
+		for _, hook := range hooks {
+			hook(e)
+		}
+	}
+	for _, sub := range subs {
+		sub.push(events)
+	}
+}
+
+// subscription is an unbounded queue feeding the channel of a subscriber
+type subscription struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  []Event
+	closed bool
+	ch     chan Event
+}
+
+func (s *subscription) push(events []Event) {
+	s.mu.Lock()
+	s.queue = append(s.queue, events...)
+	s.cond.Signal()
+	s.mu.Unlock()
+}
+
+func (s *subscription) run() {
+	defer close(s.ch)
+
+	for {
+		s.mu.Lock()
+		for len(s.queue) == 0 && !s.closed {
+			s.cond.Wait()
+		}
+		if s.closed {
+			s.mu.Unlock()
+			return
+		}
+		e := s.queue[0]
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+
+		s.ch <- e
+	}
+}
+
+// bus returns the event bus of a, it is created on first use so an
+// AuthorizationX built without New still works
+func (a *AuthorizationX) bus() *eventBus {
+	a.busOnce.Do(func() {
+		if a.events == nil {
+			a.events = newEventBus()
+		}
+	})
+
+	return a.events
+}
+
+// withTx returns a copy of a bound to the transaction, its events are held
+// until publishPending is called once the transaction is committed
+func (a *AuthorizationX) withTx(ctx context.Context, tx *gorm.DB) *AuthorizationX {
+	c := a.clone(tx)
+	c.ctx = ctx
+	c.pending = &[]Event{}
+
+	return c
+}
+
+// mutate runs fn in a transaction, the events fn adds are written to the
+// outbox in the same transaction and published once it is committed
+func (a *AuthorizationX) mutate(events *[]Event, fn func(tx *gorm.DB) error) error {
+	err := a.DB.Transaction(func(tx *gorm.DB) error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for i := range *events {
+			(*events)[i].Time = now
+		}
+		if !a.outbox {
+			return nil
+		}
+		return writeOutbox(tx, *events)
+	})
+	if err != nil {
+		return err
+	}
+
+	a.publish(*events...)
+	return nil
+}
+
+// publish emits the events, or holds them when a is bound to a transaction
+func (a *AuthorizationX) publish(events ...Event) {
+	if len(events) == 0 {
+		return
+	}
+	if a.pending != nil {
+		*a.pending = append(*a.pending, events...)
+		return
+	}
+
+	a.bus().emit(events)
+}
+
+// publishPending publishes the events held by txAuth
+func (a *AuthorizationX) publishPending(txAuth *AuthorizationX) {
+	a.publish(*txAuth.pending...)
+}
+
+// roleHolders returns the users assigned the role
+func roleHolders(tx *gorm.DB, roleID uint) ([]uint, error) {
+	var userIDs []uint
+	res := tx.Model(&UserRole{}).Where("role_id = ?", roleID).Pluck("user_id", &userIDs)
+
+	return userIDs, res.Error
+}
+
+// permissionGrantees returns the names of the active roles granted the
+// permission
+func permissionGrantees(tx *gorm.DB, permID uint) ([]string, error) {
+	var roleNames []string
+	res := tx.Model(&Role{}).
+		Where("id IN (?)", tx.Model(&RolePermission{}).Select("role_id").Where("permission_id = ?", permID)).
+		Pluck("name", &roleNames)
+
+	return roleNames, res.Error
+}
+
+func roleAssignedEvents(userRoles []UserRole, roles []Role) []Event {
+	names := make(map[uint]string, len(roles))
+	for _, role := range roles {
+		names[role.ID] = role.Name
+	}
+
+	events := make([]Event, len(userRoles))
+	for i, ur := range userRoles {
+		events[i] = Event{Type: RoleAssigned, Role: names[ur.RoleID], UserID: ur.UserID}
+	}
+
+	return events
+}
@@ -0,0 +1,78 @@
+// Package guardtest holds the fake checkers and the cases shared by the tests
+// of the middleware adapters, so the adapters are held to the same behaviour
+package guardtest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// UserHeader is the request header the tests read the user id from, the
+// adapters store it where their default subject extractor reads it
+const UserHeader = "X-User"
+
+// Checker allows the permission "permission-a" and the role "role-a" to the
+// user 1, checking the permission "broken" fails
+type Checker struct{}
+
+func (Checker) CheckPermission(userID uint, permName string) (bool, error) {
+	if permName == "broken" {
+		return false, errors.New("broken check")
+	}
+	return userID == 1 && permName == "permission-a", nil
+}
+
+func (Checker) CheckRole(userID uint, roleName string) (bool, error) {
+	return userID == 1 && roleName == "role-a", nil
+}
+
+// RequestKey marks the context of the requests in the tests
+type RequestKey struct{}
+
+// ContextChecker only allows the checks made with a context carrying
+// RequestKey
+type ContextChecker struct{ Checker }
+
+func (ContextChecker) CheckPermissionContext(ctx context.Context, userID uint, permName string) (bool, error) {
+	return ctx.Value(RequestKey{}) != nil, nil
+}
+
+func (ContextChecker) CheckRoleContext(ctx context.Context, userID uint, roleName string) (bool, error) {
+	return ctx.Value(RequestKey{}) != nil, nil
+}
+
+// Case is a request of a user, empty when missing, and the status the guard
+// replies with
+type Case struct {
+	Path   string
+	User   string
+	Status int
+}
+
+// Cases are the requests to /permission requiring "permission-a", to /role
+// requiring "role-a" and to /broken requiring "broken", with Checker
+var Cases = []Case{
+	{"/permission", "1", http.StatusOK},
+	{"/permission", "2", http.StatusForbidden},
+	{"/permission", "", http.StatusUnauthorized},
+	{"/role", "1", http.StatusOK},
+	{"/role", "2", http.StatusForbidden},
+	{"/broken", "1", http.StatusInternalServerError},
+}
+
+// Run sends the requests of Cases to serve, which returns the status of the
+// response
+func Run(t *testing.T, serve func(req *http.Request) int) {
+	t.Helper()
+
+	for _, tt := range Cases {
+		req := httptest.NewRequest(http.MethodGet, tt.Path, nil)
+		req.Header.Set(UserHeader, tt.User)
+		if status := serve(req); status != tt.Status {
+			t.Errorf("%s as %q: expecting status %d, got %d", tt.Path, tt.User, tt.Status, status)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+// Package subject converts the values stored by the web frameworks into user
+// ids for the middleware adapters
+package subject
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// ErrMissing is the ErrMissingSubject of every adapter, so they fail alike
+var ErrMissing = errors.New("missing subject")
+
+// Status is the status code the adapters reply with by default to a request
+// which is not allowed, err is nil when the user lacks the permission or role
+func Status(err error) int {
+	switch {
+	case err == nil:
+		return http.StatusForbidden
+	case errors.Is(err, ErrMissing):
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// UserID converts v into a user id, it accepts the integer types and decimal
+// strings
+func UserID(v any) (uint, bool) {
+	switch id := v.(type) {
+	case uint:
+		return id, true
+	case uint32:
+		return uint(id), true
+	case uint64:
+		return uint(id), true
+	case int:
+		if id >= 0 {
+			return uint(id), true
+		}
+	case int32:
+		if id >= 0 {
+			return uint(id), true
+		}
+	case int64:
+		if id >= 0 {
+			return uint(id), true
+		}
+	case string:
+		n, err := strconv.ParseUint(id, 10, 0)
+		if err == nil {
+			return uint(n), true
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,51 @@
+// Package testdb opens the database the test suites run against, so the same
+// tests can be run on every supported backend
+package testdb
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/joho/godotenv"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Open connects to the backend selected by the AUTHZ_TEST_DRIVER environment
+// variable: sqlite (the default, in memory), postgres or mysql. AUTHZ_TEST_DSN
+// overrides the DSN, otherwise postgres and mysql connect to the local
+// authorizationGo database with the DbUser and DbPassword variables which can
+// be set in a .env file. name keeps the in memory databases of different test
+// packages apart.
+func Open(name string) (*gorm.DB, error) {
+	// the .env file is optional
+	godotenv.Load()
+
+	dsn := os.Getenv("AUTHZ_TEST_DSN")
+	config := &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)}
+
+	switch driver := os.Getenv("AUTHZ_TEST_DRIVER"); driver {
+	case "", "sqlite":
+		if dsn == "" {
+			dsn = fmt.Sprintf("file:%s?mode=memory&cache=shared", name)
+		}
+		return gorm.Open(sqlite.Open(dsn), config)
+	case "postgres":
+		if dsn == "" {
+			dsn = fmt.Sprintf("host=localhost user=%s password=%s dbname=authorizationGo port=5432 sslmode=disable TimeZone=Asia/Shanghai",
+				os.Getenv("DbUser"), os.Getenv("DbPassword"))
+		}
+		return gorm.Open(postgres.Open(dsn), config)
+	case "mysql":
+		if dsn == "" {
+			dsn = fmt.Sprintf("%s:%s@tcp(localhost:3306)/authorizationGo?parseTime=true",
+				os.Getenv("DbUser"), os.Getenv("DbPassword"))
+		}
+		return gorm.Open(mysql.Open(dsn), config)
+	default:
+		return nil, fmt.Errorf("unknown AUTHZ_TEST_DRIVER %q", driver)
+	}
+}
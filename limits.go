@@ -0,0 +1,190 @@
+package AuthorizationGo
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RoleLimit is the maximum number of users holding a role
+type RoleLimit struct {
+	ID         uint
+	RoleID     uint `gorm:"uniqueIndex"`
+	MaxHolders int
+}
+
+func (r RoleLimit) TableName() string {
+	return tablePrefix + "role_limits"
+}
+
+// UserLimit is the maximum number of roles held by a user
+type UserLimit struct {
+	ID       uint
+	UserID   uint `gorm:"uniqueIndex"`
+	MaxRoles int
+}
+
+func (u UserLimit) TableName() string {
+	return tablePrefix + "user_limits"
+}
+
+// SetRoleMaxHolders limits the number of users holding the role, zero removes
+// the limit. The existing assignments are kept even above the limit, the
+// methods assigning roles fail with ErrAssignmentLimit once it is reached.
+func (a *AuthorizationX) SetRoleMaxHolders(roleName string, max int) (err error) {
+	op := a.startSpan("SetRoleMaxHolders", roleAttr(roleName))
+	defer op.end(&err)
+
+	roles, err := findRoles(a.DB, []string{roleName})
+	if err != nil {
+		return err
+	}
+
+	if max <= 0 {
+		return a.DB.Where("role_id = ?", roles[0].ID).Delete(&RoleLimit{}).Error
+	}
+	return a.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "role_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"max_holders"}),
+	}).Create(&RoleLimit{RoleID: roles[0].ID, MaxHolders: max}).Error
+}
+
+// GetRoleMaxHolders returns the maximum number of users holding the role, zero
+// when it is not limited
+func (a *AuthorizationX) GetRoleMaxHolders(roleName string) (max int, err error) {
+	op := a.startSpan("GetRoleMaxHolders", roleAttr(roleName))
+	defer op.end(&err)
+
+	roles, err := findRoles(a.DB, []string{roleName})
+	if err != nil {
+		return 0, err
+	}
+
+	var limits []RoleLimit
+	if err := a.DB.Where("role_id = ?", roles[0].ID).Find(&limits).Error; err != nil {
+		return 0, err
+	}
+	if len(limits) == 0 {
+		return 0, nil
+	}
+
+	return limits[0].MaxHolders, nil
+}
+
+// SetUserMaxRoles limits the number of roles held by the user, zero removes the
+// limit. The existing assignments are kept even above the limit, the methods
+// assigning roles fail with ErrAssignmentLimit once it is reached.
+func (a *AuthorizationX) SetUserMaxRoles(userID uint, max int) (err error) {
+	op := a.startSpan("SetUserMaxRoles", userAttr(userID))
+	defer op.end(&err)
+
+	if max <= 0 {
+		return a.DB.Where("user_id = ?", userID).Delete(&UserLimit{}).Error
+	}
+	return a.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"max_roles"}),
+	}).Create(&UserLimit{UserID: userID, MaxRoles: max}).Error
+}
+
+// GetUserMaxRoles returns the maximum number of roles held by the user, zero
+// when it is not limited
+func (a *AuthorizationX) GetUserMaxRoles(userID uint) (max int, err error) {
+	op := a.startSpan("GetUserMaxRoles", userAttr(userID))
+	defer op.end(&err)
+
+	var limits []UserLimit
+	if err := a.DB.Where("user_id = ?", userID).Find(&limits).Error; err != nil {
+		return 0, err
+	}
+	if len(limits) == 0 {
+		return 0, nil
+	}
+
+	return limits[0].MaxRoles, nil
+}
+
+// checkAssignmentLimits fails with ErrAssignmentLimit when creating the
+// assignments would exceed the limit of a role or of a user. The limits are
+// locked until the end of the transaction so concurrent assignments are
+// counted one after the other, the roles deleted with WithForce are not
+// counted. without is a role the users are losing at the same time, or zero.
+func checkAssignmentLimits(tx *gorm.DB, userRoles []UserRole, without uint) error {
+	if len(userRoles) == 0 {
+		return nil
+	}
+
+	added := map[uint]int{}
+	gained := map[uint]int{}
+	for _, ur := range userRoles {
+		added[ur.RoleID]++
+		gained[ur.UserID]++
+	}
+
+	locked, counted := tx, tx
+	switch tx.Dialector.Name() {
+	case "sqlite":
+		// sqlite serializes the transactions writing anyway
+	case "mysql":
+		// a plain read of repeatable read uses the snapshot of the first read
+		// of the transaction, which misses the assignments committed while
+		// waiting for the lock
+		locked = tx.Clauses(clause.Locking{Strength: "UPDATE"})
+		counted = locked
+	default:
+		// postgres refuses to lock a count, the reads of read committed see
+		// the assignments committed while waiting for the lock
+		locked = tx.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+
+	var roleLimits []RoleLimit
+	if err := locked.Where("role_id IN (?)", mapKeys(added)).Find(&roleLimits).Error; err != nil {
+		return err
+	}
+	for _, limit := range roleLimits {
+		var holders int64
+		if err := counted.Model(&UserRole{}).Where("role_id = ?", limit.RoleID).Count(&holders).Error; err != nil {
+			return err
+		}
+		if int(holders)+added[limit.RoleID] > limit.MaxHolders {
+			var role Role
+			if err := tx.Unscoped().Where("id = ?", limit.RoleID).First(&role).Error; err != nil {
+				return err
+			}
+			return fmt.Errorf("%w: role %s is limited to %d users", ErrAssignmentLimit, role.Name, limit.MaxHolders)
+		}
+	}
+
+	var userLimits []UserLimit
+	if err := locked.Where("user_id IN (?)", mapKeys(gained)).Find(&userLimits).Error; err != nil {
+		return err
+	}
+	roles := tx.Statement.Quote(tableName(tx, Role{}))
+	for _, limit := range userLimits {
+		var held int64
+		query := counted.Model(&UserRole{}).
+			Joins("JOIN "+roles+" r ON r.id = role_id AND r.deleted_at IS NULL").
+			Where("user_id = ?", limit.UserID)
+		if without != 0 {
+			query = query.Where("role_id <> ?", without)
+		}
+		if err := query.Count(&held).Error; err != nil {
+			return err
+		}
+		if int(held)+gained[limit.UserID] > limit.MaxRoles {
+			return fmt.Errorf("%w: user %d is limited to %d roles", ErrAssignmentLimit, limit.UserID, limit.MaxRoles)
+		}
+	}
+
+	return nil
+}
+
+func mapKeys(m map[uint]int) []uint {
+	keys := make([]uint, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
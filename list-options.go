@@ -0,0 +1,81 @@
+package AuthorizationGo
+
+import (
+	"math"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// SortOrder is the order of the results returned by the List methods
+type SortOrder int
+
+const (
+	SortByNameAsc SortOrder = iota
+	SortByNameDesc
+	SortByIDAsc
+	SortByIDDesc
+)
+
+// ListOptions paginates, filters and sorts the results of the List methods
+type ListOptions struct {
+	// Limit is the maximum number of results, zero means no limit
+	Limit int
+	// Offset is the number of results to skip
+	Offset int
+	// Prefix keeps only the names starting with the given value, ignoring
+	// case
+	Prefix string
+	// Contains keeps only the names containing the given value, ignoring case
+	Contains string
+	// Sort is the order of the results, by name ascending by default
+	Sort SortOrder
+}
+
+// apply adds the filters, order and pagination to the query, nameColumn is
+// empty when the results have no name
+func (o ListOptions) apply(db *gorm.DB, nameColumn string, idColumn string) *gorm.DB {
+	if nameColumn != "" {
+		// LIKE ignores case on sqlite and with the default mysql collations
+		// but not on postgres, lowering both sides gives the same results on
+		// every backend
+		if o.Prefix != "" {
+			db = db.Where("LOWER("+nameColumn+") LIKE LOWER(?) ESCAPE '!'", escapeLike(o.Prefix)+"%")
+		}
+		if o.Contains != "" {
+			db = db.Where("LOWER("+nameColumn+") LIKE LOWER(?) ESCAPE '!'", "%"+escapeLike(o.Contains)+"%")
+		}
+	} else {
+		nameColumn = idColumn
+	}
+
+	switch o.Sort {
+	case SortByNameDesc:
+		db = db.Order(nameColumn + " DESC")
+	case SortByIDAsc:
+		db = db.Order(idColumn)
+	case SortByIDDesc:
+		db = db.Order(idColumn + " DESC")
+	default:
+		db = db.Order(nameColumn)
+	}
+
+	if o.Limit > 0 {
+		db = db.Limit(o.Limit)
+	} else if o.Offset > 0 {
+		// mysql does not accept an offset without a limit
+		db = db.Limit(math.MaxInt32)
+	}
+	if o.Offset > 0 {
+		db = db.Offset(o.Offset)
+	}
+
+	return db
+}
+
+var likeReplacer = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// escapeLike escapes the LIKE wildcards using ! as the escape character
+func escapeLike(s string) string {
+	return likeReplacer.Replace(s)
+}
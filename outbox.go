@@ -0,0 +1,172 @@
+package AuthorizationGo
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// OutboxRecord is an event written to the outbox table in the transaction of
+// the change, it is deleted once a Relay published it
+type OutboxRecord struct {
+	ID         uint
+	Type       string `gorm:"size:64"`
+	Role       string `gorm:"size:255"`
+	Permission string `gorm:"size:255"`
+	UserID     uint
+	NewName    string `gorm:"size:255"`
+	CreatedAt  time.Time
+}
+
+func (o OutboxRecord) TableName() string {
+	return tablePrefix + "outbox"
+}
+
+// Event returns the event recorded
+func (o OutboxRecord) Event() Event {
+	return Event{
+		Type:       EventType(o.Type),
+		Role:       o.Role,
+		Permission: o.Permission,
+		UserID:     o.UserID,
+		NewName:    o.NewName,
+		Time:       o.CreatedAt,
+	}
+}
+
+func writeOutbox(tx *gorm.DB, events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	records := make([]OutboxRecord, len(events))
+	for i, e := range events {
+		records[i] = OutboxRecord{
+			Type:       string(e.Type),
+			Role:       e.Role,
+			Permission: e.Permission,
+			UserID:     e.UserID,
+			NewName:    e.NewName,
+			CreatedAt:  e.Time,
+		}
+	}
+
+	return tx.CreateInBatches(records, insertBatchSize).Error
+}
+
+// Publisher delivers outbox records to other services. Delivery is at least
+// once: records are published again when the relay stops before deleting
+// them, so consumers should ignore the ids they already handled.
+type Publisher interface {
+	Publish(ctx context.Context, records []OutboxRecord) error
+}
+
+// PublisherFunc adapts a function to Publisher
+type PublisherFunc func(ctx context.Context, records []OutboxRecord) error
+
+func (f PublisherFunc) Publish(ctx context.Context, records []OutboxRecord) error {
+	return f(ctx, records)
+}
+
+// RelayOptions controls a Relay, zero values use the defaults
+type RelayOptions struct {
+	// BatchSize is the number of records published at once, 100 by default
+	BatchSize int
+	// Interval is the time between two polls of the outbox, 1s by default
+	Interval time.Duration
+	// OnError is called with the errors of Run, which keeps polling
+	OnError func(error)
+}
+
+// Relay publishes the records of the outbox, oldest id first. The ids are taken
+// when the changes are written but the transactions commit in any order, so a
+// record can be published after records with a greater id and consumers should
+// not rely on the id order. Several relays can run against the same outbox for
+// availability, they take turns: a relay keeps its transaction open and the
+// records of its batch locked while the publisher runs, the other relays wait
+// for it, so a slow publisher holds the locks as long as it takes.
+type Relay struct {
+	db        *gorm.DB
+	publisher Publisher
+	opts      RelayOptions
+}
+
+// NewRelay returns a relay publishing the outbox of a to the publisher
+func (a *AuthorizationX) NewRelay(publisher Publisher, opts RelayOptions) *Relay {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+
+	return &Relay{db: a.DB, publisher: publisher, opts: opts}
+}
+
+// Run flushes the outbox every interval until the context is done
+func (r *Relay) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.Flush(ctx); err != nil && ctx.Err() == nil && r.opts.OnError != nil {
+			r.opts.OnError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Flush publishes the records of the outbox batch by batch until it is empty
+// and returns the number of records published
+func (r *Relay) Flush(ctx context.Context) (int, error) {
+	total := 0
+	for {
+		n, err := r.publishBatch(ctx)
+		total += n
+		if err != nil || n < r.opts.BatchSize {
+			return total, err
+		}
+	}
+}
+
+// publishBatch publishes the oldest records and deletes them in a single
+// transaction, they stay in the outbox when publishing fails
+func (r *Relay) publishBatch(ctx context.Context) (int, error) {
+	var records []OutboxRecord
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		query := tx.Order("id").Limit(r.opts.BatchSize)
+		if tx.Dialector.Name() != "sqlite" {
+			// wait for the batch of another relay rather than skipping it,
+			// the relays publish one batch at a time
+			query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+		}
+		if err := query.Find(&records).Error; err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			return nil
+		}
+
+		if err := r.publisher.Publish(ctx, records); err != nil {
+			return err
+		}
+
+		ids := make([]uint, len(records))
+		for i, record := range records {
+			ids[i] = record.ID
+		}
+		return tx.Where("id IN (?)", ids).Delete(&OutboxRecord{}).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(records), nil
+}
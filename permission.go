@@ -1,8 +1,11 @@
 package AuthorizationGo
 
+import "gorm.io/gorm"
+
 type Permission struct {
-	ID   uint
-	Name string
+	ID        uint
+	Name      string `gorm:"size:255;index"`
+	DeletedAt gorm.DeletedAt `gorm:"index"`
 }
 
 func (p Permission) TableName() string {
@@ -0,0 +1,152 @@
+package AuthorizationGo
+
+import "gorm.io/gorm"
+
+// Policy describes roles, permissions and user assignments independently of
+// the database ids so it can be exported and imported
+type Policy struct {
+	Permissions []string     `json:"permissions"`
+	Roles       []RolePolicy `json:"roles"`
+	Users       []UserPolicy `json:"users"`
+}
+
+// RolePolicy is a role and the permissions granted to it
+type RolePolicy struct {
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+}
+
+// UserPolicy is a user and the roles assigned to it
+type UserPolicy struct {
+	ID    uint     `json:"id"`
+	Roles []string `json:"roles"`
+}
+
+// ExportPolicy returns the active roles, permissions and assignments sorted by
+// name and user id
+func (a *AuthorizationX) ExportPolicy() (policy *Policy, err error) {
+	op := a.startSpan("ExportPolicy")
+	defer op.end(&err)
+
+	roles := a.DB.Statement.Quote(tableName(a.DB, Role{}))
+	perms := a.DB.Statement.Quote(tableName(a.DB, Permission{}))
+	rolePerms := a.DB.Statement.Quote(tableName(a.DB, RolePermission{}))
+	userRoles := a.DB.Statement.Quote(tableName(a.DB, UserRole{}))
+
+	policy = &Policy{Permissions: []string{}, Roles: []RolePolicy{}, Users: []UserPolicy{}}
+
+	res := a.DB.Model(&Permission{}).Order("name").Pluck("name", &policy.Permissions)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	var roleNames []string
+	res = a.DB.Model(&Role{}).Order("name").Pluck("name", &roleNames)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	// get the grants of all the roles at once
+	var grants []struct {
+		RoleName string
+		PermName string
+	}
+	res = a.DB.Model(&RolePermission{}).
+		Select(roles+".name AS role_name, "+perms+".name AS perm_name").
+		Joins("JOIN "+roles+" ON "+roles+".id = "+rolePerms+".role_id AND "+roles+".deleted_at IS NULL").
+		Joins("JOIN "+perms+" ON "+perms+".id = "+rolePerms+".permission_id AND "+perms+".deleted_at IS NULL").
+		Order(perms + ".name").
+		Scan(&grants)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	rolePermissions := map[string][]string{}
+	for _, g := range grants {
+		rolePermissions[g.RoleName] = append(rolePermissions[g.RoleName], g.PermName)
+	}
+	for _, name := range roleNames {
+		permNames := rolePermissions[name]
+		if permNames == nil {
+			permNames = []string{}
+		}
+		policy.Roles = append(policy.Roles, RolePolicy{Name: name, Permissions: permNames})
+	}
+
+	// get the assignments of all the users at once
+	var assignments []struct {
+		UserID   uint
+		RoleName string
+	}
+	res = a.DB.Model(&UserRole{}).
+		Select(userRoles+".user_id AS user_id, "+roles+".name AS role_name").
+		Joins("JOIN "+roles+" ON "+roles+".id = "+userRoles+".role_id AND "+roles+".deleted_at IS NULL").
+		Order(userRoles + ".user_id").
+		Order(roles + ".name").
+		Scan(&assignments)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	for _, as := range assignments {
+		n := len(policy.Users)
+		if n == 0 || policy.Users[n-1].ID != as.UserID {
+			policy.Users = append(policy.Users, UserPolicy{ID: as.UserID})
+			n++
+		}
+		policy.Users[n-1].Roles = append(policy.Users[n-1].Roles, as.RoleName)
+	}
+
+	return policy, nil
+}
+
+// ImportPolicy adds the roles, permissions and assignments of the policy in a
+// single transaction, existing entries are kept. Permissions granted to a role
+// are created even when they are not listed in Permissions.
+func (a *AuthorizationX) ImportPolicy(policy *Policy) (err error) {
+	op := a.startSpan("ImportPolicy")
+	defer op.end(&err)
+
+	var txAuth *AuthorizationX
+	err = a.DB.Transaction(func(tx *gorm.DB) error {
+		txAuth = a.withTx(op.ctx, tx)
+
+		for _, perm := range policy.Permissions {
+			if err := txAuth.CreatePermission(perm); err != nil {
+				return err
+			}
+		}
+
+		for _, role := range policy.Roles {
+			if err := txAuth.CreateRole(role.Name); err != nil {
+				return err
+			}
+			for _, perm := range role.Permissions {
+				if err := txAuth.CreatePermission(perm); err != nil {
+					return err
+				}
+			}
+			if len(role.Permissions) > 0 {
+				if err := txAuth.AssignPermissions(role.Name, role.Permissions); err != nil {
+					return err
+				}
+			}
+		}
+
+		// the roles of a user are assigned together so the prerequisites are
+		// satisfied whatever their order
+		for _, user := range policy.Users {
+			if err := txAuth.AssignRoles(user.ID, user.Roles); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	a.publishPending(txAuth)
+	return nil
+}
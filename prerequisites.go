@@ -0,0 +1,294 @@
+package AuthorizationGo
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// RolePrerequisite is a role a user must hold before being assigned another
+type RolePrerequisite struct {
+	ID                 uint
+	RoleID             uint `gorm:"index"`
+	PrerequisiteRoleID uint `gorm:"index"`
+}
+
+func (r RolePrerequisite) TableName() string {
+	return tablePrefix + "role_prerequisites"
+}
+
+// AddRolePrerequisite makes the prerequisite role required to be assigned the
+// role, declaring it twice is ignored. It fails with ErrMissingPrerequisite
+// while a holder of the role lacks the prerequisite and with
+// ErrPrerequisiteCycle when the role is already a prerequisite of the
+// prerequisite.
+func (a *AuthorizationX) AddRolePrerequisite(roleName, prerequisiteName string) (err error) {
+	op := a.startSpan("AddRolePrerequisite", roleAttr(roleName), prerequisiteRoleAttr(prerequisiteName))
+	defer op.end(&err)
+
+	return a.DB.Transaction(func(tx *gorm.DB) error {
+		role, prerequisite, err := findPrerequisitePair(tx, roleName, prerequisiteName)
+		if err != nil {
+			return err
+		}
+
+		// walk the prerequisites of the prerequisite looking for the role
+		visited := map[uint]bool{prerequisite.ID: true}
+		next := []uint{prerequisite.ID}
+		for len(next) > 0 {
+			var ids []uint
+			res := tx.Model(&RolePrerequisite{}).Where("role_id IN (?)", next).Pluck("prerequisite_role_id", &ids)
+			if res.Error != nil {
+				return res.Error
+			}
+			next = next[:0]
+			for _, id := range ids {
+				if id == role.ID {
+					return fmt.Errorf("%w: %s requires %s", ErrPrerequisiteCycle, prerequisiteName, roleName)
+				}
+				if !visited[id] {
+					visited[id] = true
+					next = append(next, id)
+				}
+			}
+		}
+
+		// make sure the holders of the role hold the prerequisite
+		var userRole UserRole
+		res := tx.Where("role_id = ?", role.ID).
+			Where("user_id NOT IN (?)", tx.Model(&UserRole{}).Select("user_id").Where("role_id = ?", prerequisite.ID)).
+			First(&userRole)
+		if res.Error == nil {
+			return fmt.Errorf("%w: user %d holds %s without %s", ErrMissingPrerequisite, userRole.UserID, roleName, prerequisiteName)
+		}
+		if !errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return res.Error
+		}
+
+		link := RolePrerequisite{RoleID: role.ID, PrerequisiteRoleID: prerequisite.ID}
+		return tx.Where(&link).FirstOrCreate(&link).Error
+	})
+}
+
+// RemoveRolePrerequisite no longer requires the prerequisite role to be
+// assigned the role
+func (a *AuthorizationX) RemoveRolePrerequisite(roleName, prerequisiteName string) (err error) {
+	op := a.startSpan("RemoveRolePrerequisite", roleAttr(roleName), prerequisiteRoleAttr(prerequisiteName))
+	defer op.end(&err)
+
+	role, prerequisite, err := findPrerequisitePair(a.DB, roleName, prerequisiteName)
+	if err != nil {
+		return err
+	}
+
+	return a.DB.Where("role_id = ?", role.ID).Where("prerequisite_role_id = ?", prerequisite.ID).Delete(&RolePrerequisite{}).Error
+}
+
+// GetRolePrerequisites returns the names of the roles directly required to be
+// assigned the role
+func (a *AuthorizationX) GetRolePrerequisites(roleName string) (names []string, err error) {
+	op := a.startSpan("GetRolePrerequisites", roleAttr(roleName))
+	defer op.end(&err)
+
+	roles, err := findRoles(a.DB, []string{roleName})
+	if err != nil {
+		return nil, err
+	}
+
+	prerequisites, err := findPrerequisites(a.DB, roleIDs(roles))
+	if err != nil {
+		return nil, err
+	}
+
+	names = []string{}
+	for _, p := range prerequisites {
+		names = append(names, p.prerequisite)
+	}
+
+	return names, nil
+}
+
+// findPrerequisitePair returns the role and its prerequisite
+func findPrerequisitePair(tx *gorm.DB, roleName, prerequisiteName string) (Role, Role, error) {
+	if roleName == prerequisiteName {
+		return Role{}, Role{}, fmt.Errorf("%w: %s requires itself", ErrPrerequisiteCycle, roleName)
+	}
+
+	roles, err := findRoles(tx, []string{roleName, prerequisiteName})
+	if err != nil {
+		return Role{}, Role{}, err
+	}
+	if roles[0].Name != roleName {
+		roles[0], roles[1] = roles[1], roles[0]
+	}
+
+	return roles[0], roles[1], nil
+}
+
+// rolePrerequisite is a prerequisite between two active roles along with their
+// names
+type rolePrerequisite struct {
+	roleID         uint
+	prerequisiteID uint
+	role           string
+	prerequisite   string
+}
+
+// findPrerequisites returns the prerequisites of the roles between active
+// roles, sorted by role names
+func findPrerequisites(tx *gorm.DB, ids []uint) ([]rolePrerequisite, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	roles := tx.Statement.Quote(tableName(tx, Role{}))
+	prerequisites := tx.Statement.Quote(tableName(tx, RolePrerequisite{}))
+
+	var rows []struct {
+		RoleID             uint
+		PrerequisiteRoleID uint
+		RoleName           string
+		PrerequisiteName   string
+	}
+	res := tx.Model(&RolePrerequisite{}).
+		Select(prerequisites+".role_id, "+prerequisites+".prerequisite_role_id, r.name AS role_name, p.name AS prerequisite_name").
+		Joins("JOIN "+roles+" r ON r.id = "+prerequisites+".role_id AND r.deleted_at IS NULL").
+		Joins("JOIN "+roles+" p ON p.id = "+prerequisites+".prerequisite_role_id AND p.deleted_at IS NULL").
+		Where(prerequisites+".role_id IN (?)", ids).
+		Order("r.name").
+		Order("p.name").
+		Scan(&rows)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	result := make([]rolePrerequisite, len(rows))
+	for i, row := range rows {
+		result[i] = rolePrerequisite{
+			roleID:         row.RoleID,
+			prerequisiteID: row.PrerequisiteRoleID,
+			role:           row.RoleName,
+			prerequisite:   row.PrerequisiteName,
+		}
+	}
+
+	return result, nil
+}
+
+// checkPrerequisites fails with ErrMissingPrerequisite when one of the users
+// would hold one of the roles without its prerequisites, the roles assigned
+// together count. without is a role the users are losing at the same time, or
+// zero.
+func checkPrerequisites(tx *gorm.DB, userIDs []uint, ids []uint, without uint) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	prerequisites, err := findPrerequisites(tx, ids)
+	if err != nil || len(prerequisites) == 0 {
+		return err
+	}
+
+	// find the other roles of the users
+	var existing []UserRole
+	query := tx.Where("user_id IN (?)", userIDs)
+	if without != 0 {
+		query = query.Where("role_id <> ?", without)
+	}
+	if err := query.Find(&existing).Error; err != nil {
+		return err
+	}
+
+	held := make(map[uint]map[uint]bool, len(userIDs))
+	for _, userID := range userIDs {
+		held[userID] = map[uint]bool{}
+		for _, id := range ids {
+			held[userID][id] = true
+		}
+	}
+	for _, ur := range existing {
+		held[ur.UserID][ur.RoleID] = true
+	}
+
+	for _, userID := range userIDs {
+		for _, p := range prerequisites {
+			if !held[userID][p.prerequisiteID] {
+				return fmt.Errorf("%w: user %d needs %s to hold %s", ErrMissingPrerequisite, userID, p.prerequisite, p.role)
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkDependents fails with ErrMissingPrerequisite when a user holds a role
+// requiring the role without holding it
+func checkDependents(tx *gorm.DB, role Role) error {
+	var row struct {
+		UserID uint
+		Name   string
+	}
+	res := tx.Model(&UserRole{}).
+		Select("user_id, name").
+		Joins("JOIN "+tx.Statement.Quote(tableName(tx, Role{}))+" r ON r.id = role_id AND r.deleted_at IS NULL").
+		Where("role_id IN (?)", tx.Model(&RolePrerequisite{}).Select("role_id").Where("prerequisite_role_id = ?", role.ID)).
+		Where("user_id NOT IN (?)", tx.Model(&UserRole{}).Select("user_id").Where("role_id = ?", role.ID)).
+		Limit(1).
+		Scan(&row)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 {
+		return fmt.Errorf("%w: user %d holds %s without %s", ErrMissingPrerequisite, row.UserID, row.Name, role.Name)
+	}
+
+	return nil
+}
+
+// revokeDependents handles the roles of the user requiring one of the revoked
+// roles, they are revoked in turn when dependents is set, otherwise it fails
+// with ErrRoleRequired. It returns the events of the revoked roles.
+func revokeDependents(tx *gorm.DB, userID uint, revoked []uint, dependents bool) ([]Event, error) {
+	var events []Event
+	for len(revoked) > 0 {
+		var held []uint
+		res := tx.Model(&UserRole{}).Where("user_id = ?", userID).Pluck("role_id", &held)
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		prerequisites, err := findPrerequisites(tx, held)
+		if err != nil {
+			return nil, err
+		}
+
+		isRevoked := make(map[uint]bool, len(revoked))
+		for _, id := range revoked {
+			isRevoked[id] = true
+		}
+		var next []uint
+		seen := map[uint]bool{}
+		for _, p := range prerequisites {
+			if !isRevoked[p.prerequisiteID] || seen[p.roleID] {
+				continue
+			}
+			if !dependents {
+				return nil, fmt.Errorf("%w: %s of user %d requires %s", ErrRoleRequired, p.role, userID, p.prerequisite)
+			}
+			seen[p.roleID] = true
+			next = append(next, p.roleID)
+			events = append(events, Event{Type: RoleRevoked, Role: p.role, UserID: userID})
+		}
+		revoked = next
+		if len(revoked) == 0 {
+			break
+		}
+
+		res = tx.Where("user_id = ?", userID).Where("role_id IN (?)", revoked).Delete(UserRole{})
+		if res.Error != nil {
+			return nil, res.Error
+		}
+	}
+
+	return events, nil
+}
@@ -0,0 +1,330 @@
+package AuthorizationGo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ChangeKind is the kind of a change of a plan
+type ChangeKind string
+
+const (
+	CreatePermissionChange ChangeKind = "create-permission"
+	CreateRoleChange       ChangeKind = "create-role"
+	GrantChange            ChangeKind = "grant"
+	AssignChange           ChangeKind = "assign"
+	RevokeChange           ChangeKind = "revoke"
+	UngrantChange          ChangeKind = "ungrant"
+	DeleteRoleChange       ChangeKind = "delete-role"
+	DeletePermissionChange ChangeKind = "delete-permission"
+)
+
+// Change is a single creation or deletion of a role, a permission, a grant or
+// an assignment
+type Change struct {
+	Kind       ChangeKind `json:"kind"`
+	Role       string     `json:"role,omitempty"`
+	Permission string     `json:"permission,omitempty"`
+	UserID     uint       `json:"user_id,omitempty"`
+}
+
+// String returns the change as a line of a plan, + for creations and - for
+// deletions
+func (c Change) String() string {
+	switch c.Kind {
+	case CreatePermissionChange:
+		return "+ permission " + c.Permission
+	case CreateRoleChange:
+		return "+ role " + c.Role
+	case GrantChange:
+		return "+ grant " + c.Role + " " + c.Permission
+	case AssignChange:
+		return fmt.Sprintf("+ assign %d %s", c.UserID, c.Role)
+	case RevokeChange:
+		return fmt.Sprintf("- assign %d %s", c.UserID, c.Role)
+	case UngrantChange:
+		return "- grant " + c.Role + " " + c.Permission
+	case DeleteRoleChange:
+		return "- role " + c.Role
+	case DeletePermissionChange:
+		return "- permission " + c.Permission
+	}
+
+	return "? " + string(c.Kind)
+}
+
+// Plan is the list of changes converging the tables to a desired policy, in the
+// order they are applied
+type Plan struct {
+	Changes []Change `json:"changes"`
+}
+
+// Empty reports whether the tables already match the desired policy
+func (p *Plan) Empty() bool {
+	return len(p.Changes) == 0
+}
+
+// String returns the plan one change per line followed by a summary, so it can
+// be reviewed like a diff
+func (p *Plan) String() string {
+	if p.Empty() {
+		return "No changes.\n"
+	}
+
+	var b strings.Builder
+	add := 0
+	for _, c := range p.Changes {
+		b.WriteString(c.String())
+		b.WriteByte('\n')
+		if strings.HasPrefix(c.String(), "+") {
+			add++
+		}
+	}
+	fmt.Fprintf(&b, "Plan: %d to add, %d to delete.\n", add, len(p.Changes)-add)
+
+	return b.String()
+}
+
+// ReconcileOptions controls Reconcile
+type ReconcileOptions struct {
+	// Apply applies the plan in a single transaction, otherwise the plan is
+	// only computed
+	Apply bool
+	// Prune deletes the roles, permissions, grants and assignments missing
+	// from the desired policy, otherwise only the missing entries are created
+	Prune bool
+}
+
+// Reconcile computes the changes converging the active roles, permissions,
+// grants and assignments to the desired policy and applies them atomically when
+// opts.Apply is set. Permissions granted to a role and roles assigned to a user
+// are desired even when they are not listed in Permissions or Roles. Deleted
+// roles and permissions are soft deleted.
+func (a *AuthorizationX) Reconcile(desired Policy, opts ReconcileOptions) (plan *Plan, err error) {
+	op := a.startSpan("Reconcile")
+	defer op.end(&err)
+
+	var txAuth *AuthorizationX
+	err = a.DB.Transaction(func(tx *gorm.DB) error {
+		txAuth = a.withTx(op.ctx, tx)
+
+		current, err := txAuth.ExportPolicy()
+		if err != nil {
+			return err
+		}
+
+		plan = diffPolicies(current, &desired, opts.Prune)
+		if !opts.Apply {
+			return nil
+		}
+		return applyChanges(txAuth, plan.Changes)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	a.publishPending(txAuth)
+	return plan, nil
+}
+
+// policySets is a policy as sets so it can be compared
+type policySets struct {
+	permissions map[string]bool
+	roles       map[string]bool
+	grants      map[[2]string]bool
+	assignments map[Change]bool
+}
+
+func newPolicySets(policy *Policy) *policySets {
+	s := &policySets{
+		permissions: map[string]bool{},
+		roles:       map[string]bool{},
+		grants:      map[[2]string]bool{},
+		assignments: map[Change]bool{},
+	}
+
+	for _, perm := range policy.Permissions {
+		s.permissions[perm] = true
+	}
+	for _, role := range policy.Roles {
+		s.roles[role.Name] = true
+		for _, perm := range role.Permissions {
+			s.permissions[perm] = true
+			s.grants[[2]string{role.Name, perm}] = true
+		}
+	}
+	for _, user := range policy.Users {
+		for _, role := range user.Roles {
+			s.roles[role] = true
+			s.assignments[Change{Kind: AssignChange, Role: role, UserID: user.ID}] = true
+		}
+	}
+
+	return s
+}
+
+// diffPolicies returns the plan converging current to desired. Creations come
+// first so grants and assignments can reference the new entries, the
+// assignments are revoked before the new ones are made so a user can swap two
+// conflicting roles, and deletions remove the links before the roles and
+// permissions.
+func diffPolicies(current, desired *Policy, prune bool) *Plan {
+	cur := newPolicySets(current)
+	want := newPolicySets(desired)
+
+	plan := &Plan{Changes: []Change{}}
+	for _, perm := range sortedKeys(want.permissions) {
+		if !cur.permissions[perm] {
+			plan.Changes = append(plan.Changes, Change{Kind: CreatePermissionChange, Permission: perm})
+		}
+	}
+	for _, role := range sortedKeys(want.roles) {
+		if !cur.roles[role] {
+			plan.Changes = append(plan.Changes, Change{Kind: CreateRoleChange, Role: role})
+		}
+	}
+	for _, g := range sortedGrants(want.grants) {
+		if !cur.grants[g] {
+			plan.Changes = append(plan.Changes, Change{Kind: GrantChange, Role: g[0], Permission: g[1]})
+		}
+	}
+	if prune {
+		for _, c := range sortedAssignments(cur.assignments) {
+			if !want.assignments[c] {
+				plan.Changes = append(plan.Changes, Change{Kind: RevokeChange, Role: c.Role, UserID: c.UserID})
+			}
+		}
+	}
+	for _, c := range sortedAssignments(want.assignments) {
+		if !cur.assignments[c] {
+			plan.Changes = append(plan.Changes, c)
+		}
+	}
+
+	if !prune {
+		return plan
+	}
+
+	for _, g := range sortedGrants(cur.grants) {
+		if !want.grants[g] {
+			plan.Changes = append(plan.Changes, Change{Kind: UngrantChange, Role: g[0], Permission: g[1]})
+		}
+	}
+	for _, role := range sortedKeys(cur.roles) {
+		if !want.roles[role] {
+			plan.Changes = append(plan.Changes, Change{Kind: DeleteRoleChange, Role: role})
+		}
+	}
+	for _, perm := range sortedKeys(cur.permissions) {
+		if !want.permissions[perm] {
+			plan.Changes = append(plan.Changes, Change{Kind: DeletePermissionChange, Permission: perm})
+		}
+	}
+
+	return plan
+}
+
+// applyChanges applies the changes in order through the methods of a, which
+// is expected to be bound to a transaction. The consecutive assignments, or
+// revocations, of a user are applied together so the prerequisites are checked
+// against the whole set whatever the order of the role names.
+func applyChanges(a *AuthorizationX, changes []Change) error {
+	for i := 0; i < len(changes); i++ {
+		c := changes[i]
+		var err error
+		switch c.Kind {
+		case CreatePermissionChange:
+			err = a.CreatePermission(c.Permission)
+		case CreateRoleChange:
+			err = a.CreateRole(c.Role)
+		case GrantChange:
+			err = a.AssignPermissions(c.Role, []string{c.Permission})
+		case AssignChange, RevokeChange:
+			group := userChanges(changes[i:])
+			roleNames := make([]string, len(group))
+			for j, gc := range group {
+				roleNames[j] = gc.Role
+			}
+			if c.Kind == AssignChange {
+				err = a.AssignRoles(c.UserID, roleNames)
+			} else {
+				err = a.RevokeRoles(c.UserID, roleNames)
+			}
+			if err != nil && len(group) > 1 {
+				lines := make([]string, len(group))
+				for j, gc := range group {
+					lines[j] = gc.String()
+				}
+				return fmt.Errorf("%s: %w", strings.Join(lines, ", "), err)
+			}
+			i += len(group) - 1
+		case UngrantChange:
+			err = a.RevokeRolePermission(c.Role, c.Permission)
+		case DeleteRoleChange:
+			err = a.DeleteRole(c.Role)
+		case DeletePermissionChange:
+			err = a.DeletePermission(c.Permission)
+		default:
+			err = fmt.Errorf("unknown change kind %q", c.Kind)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", c, err)
+		}
+	}
+
+	return nil
+}
+
+// userChanges returns the leading changes of the same kind and user as the
+// first one
+func userChanges(changes []Change) []Change {
+	n := 1
+	for n < len(changes) && changes[n].Kind == changes[0].Kind && changes[n].UserID == changes[0].UserID {
+		n++
+	}
+
+	return changes[:n]
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func sortedGrants(set map[[2]string]bool) [][2]string {
+	grants := make([][2]string, 0, len(set))
+	for g := range set {
+		grants = append(grants, g)
+	}
+	sort.Slice(grants, func(i, j int) bool {
+		if grants[i][0] != grants[j][0] {
+			return grants[i][0] < grants[j][0]
+		}
+		return grants[i][1] < grants[j][1]
+	})
+
+	return grants
+}
+
+func sortedAssignments(set map[Change]bool) []Change {
+	changes := make([]Change, 0, len(set))
+	for c := range set {
+		changes = append(changes, c)
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].UserID != changes[j].UserID {
+			return changes[i].UserID < changes[j].UserID
+		}
+		return changes[i].Role < changes[j].Role
+	})
+
+	return changes
+}
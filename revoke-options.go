@@ -0,0 +1,25 @@
+package AuthorizationGo
+
+// RevokeOption changes the behaviour of RevokeRole and RevokeRoles
+type RevokeOption func(*revokeOptions)
+
+type revokeOptions struct {
+	dependents bool
+}
+
+// WithDependentRoles also revokes the roles of the user requiring the revoked
+// roles as prerequisites, instead of refusing the revocation
+func WithDependentRoles() RevokeOption {
+	return func(o *revokeOptions) {
+		o.dependents = true
+	}
+}
+
+func newRevokeOptions(opts []RevokeOption) revokeOptions {
+	var options revokeOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return options
+}
@@ -2,8 +2,8 @@ package AuthorizationGo
 
 type RolePermission struct {
 	ID           uint
-	RoleID       uint
-	PermissionID uint
+	RoleID       uint `gorm:"index"`
+	PermissionID uint `gorm:"index"`
 }
 
 func (r RolePermission) TableName() string {
@@ -0,0 +1,221 @@
+package AuthorizationGo
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// ConflictKind tells when two mutually exclusive roles conflict
+type ConflictKind string
+
+const (
+	// StaticConflict forbids a user to hold both roles, it is enforced by the
+	// methods assigning roles
+	StaticConflict ConflictKind = "static"
+	// DynamicConflict lets a user hold both roles but forbids to activate them
+	// in the same Session
+	DynamicConflict ConflictKind = "dynamic"
+)
+
+// RoleConflict is a pair of mutually exclusive roles, RoleID is the lowest id
+type RoleConflict struct {
+	ID                uint
+	Kind              ConflictKind `gorm:"size:16;index"`
+	RoleID            uint         `gorm:"index"`
+	ConflictingRoleID uint         `gorm:"index"`
+}
+
+func (r RoleConflict) TableName() string {
+	return tablePrefix + "role_conflicts"
+}
+
+// AddRoleConflict declares two roles mutually exclusive, declaring a pair
+// twice is ignored. A static conflict fails with ErrRoleConflict while a user
+// holds both roles.
+func (a *AuthorizationX) AddRoleConflict(kind ConflictKind, roleName, conflictingRoleName string) (err error) {
+	op := a.startSpan("AddRoleConflict", roleAttr(roleName), conflictingRoleAttr(conflictingRoleName))
+	defer op.end(&err)
+
+	return a.DB.Transaction(func(tx *gorm.DB) error {
+		conflict, err := findConflictPair(tx, kind, roleName, conflictingRoleName)
+		if err != nil {
+			return err
+		}
+
+		if kind == StaticConflict {
+			// make sure no user already holds both roles
+			var userRole UserRole
+			res := tx.Where("role_id = ?", conflict.RoleID).
+				Where("user_id IN (?)", tx.Model(&UserRole{}).Select("user_id").Where("role_id = ?", conflict.ConflictingRoleID)).
+				First(&userRole)
+			if res.Error == nil {
+				return fmt.Errorf("%w: user %d holds both %s and %s", ErrRoleConflict, userRole.UserID, roleName, conflictingRoleName)
+			}
+			if !errors.Is(res.Error, gorm.ErrRecordNotFound) {
+				return res.Error
+			}
+		}
+
+		return tx.Where(&conflict).FirstOrCreate(&conflict).Error
+	})
+}
+
+// RemoveRoleConflict lifts the conflict between two roles
+func (a *AuthorizationX) RemoveRoleConflict(kind ConflictKind, roleName, conflictingRoleName string) (err error) {
+	op := a.startSpan("RemoveRoleConflict", roleAttr(roleName), conflictingRoleAttr(conflictingRoleName))
+	defer op.end(&err)
+
+	conflict, err := findConflictPair(a.DB, kind, roleName, conflictingRoleName)
+	if err != nil {
+		return err
+	}
+
+	return a.DB.Where(&conflict).Delete(&RoleConflict{}).Error
+}
+
+// GetRoleConflicts returns the names of the roles conflicting with the role
+func (a *AuthorizationX) GetRoleConflicts(kind ConflictKind, roleName string) (names []string, err error) {
+	op := a.startSpan("GetRoleConflicts", roleAttr(roleName))
+	defer op.end(&err)
+
+	roles, err := findRoles(a.DB, []string{roleName})
+	if err != nil {
+		return nil, err
+	}
+
+	conflicts, err := findRoleConflicts(a.DB, kind, roleIDs(roles))
+	if err != nil {
+		return nil, err
+	}
+
+	names = []string{}
+	for _, c := range conflicts {
+		if c.roleID == roles[0].ID {
+			names = append(names, c.conflictingRole)
+		} else {
+			names = append(names, c.role)
+		}
+	}
+
+	return names, nil
+}
+
+// findConflictPair returns the conflict between the roles, with the lowest id
+// first
+func findConflictPair(tx *gorm.DB, kind ConflictKind, roleName, conflictingRoleName string) (RoleConflict, error) {
+	if kind != StaticConflict && kind != DynamicConflict {
+		return RoleConflict{}, fmt.Errorf("unknown conflict kind %q", kind)
+	}
+	if roleName == conflictingRoleName {
+		return RoleConflict{}, ErrRoleConflictWithSelf
+	}
+
+	roles, err := findRoles(tx, []string{roleName, conflictingRoleName})
+	if err != nil {
+		return RoleConflict{}, err
+	}
+
+	conflict := RoleConflict{Kind: kind, RoleID: roles[0].ID, ConflictingRoleID: roles[1].ID}
+	if conflict.RoleID > conflict.ConflictingRoleID {
+		conflict.RoleID, conflict.ConflictingRoleID = conflict.ConflictingRoleID, conflict.RoleID
+	}
+
+	return conflict, nil
+}
+
+// roleConflict is a conflict between two active roles along with their names
+type roleConflict struct {
+	roleID            uint
+	conflictingRoleID uint
+	role              string
+	conflictingRole   string
+}
+
+// findRoleConflicts returns the conflicts between active roles involving one
+// of the roles, sorted by role names
+func findRoleConflicts(tx *gorm.DB, kind ConflictKind, ids []uint) ([]roleConflict, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	roles := tx.Statement.Quote(tableName(tx, Role{}))
+	conflicts := tx.Statement.Quote(tableName(tx, RoleConflict{}))
+
+	var rows []struct {
+		RoleID            uint
+		ConflictingRoleID uint
+		RoleName          string
+		ConflictingName   string
+	}
+	res := tx.Model(&RoleConflict{}).
+		Select(conflicts+".role_id, "+conflicts+".conflicting_role_id, r.name AS role_name, c.name AS conflicting_name").
+		Joins("JOIN "+roles+" r ON r.id = "+conflicts+".role_id AND r.deleted_at IS NULL").
+		Joins("JOIN "+roles+" c ON c.id = "+conflicts+".conflicting_role_id AND c.deleted_at IS NULL").
+		Where(conflicts+".kind = ?", kind).
+		Where(tx.Where(conflicts+".role_id IN (?)", ids).Or(conflicts+".conflicting_role_id IN (?)", ids)).
+		Order("r.name").
+		Order("c.name").
+		Scan(&rows)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	result := make([]roleConflict, len(rows))
+	for i, row := range rows {
+		result[i] = roleConflict{
+			roleID:            row.RoleID,
+			conflictingRoleID: row.ConflictingRoleID,
+			role:              row.RoleName,
+			conflictingRole:   row.ConflictingName,
+		}
+	}
+
+	return result, nil
+}
+
+// checkRoleConflicts fails with ErrRoleConflict when assigning the roles to
+// the users would make one of them hold two statically conflicting roles.
+// without is a role the users are losing at the same time, or zero.
+func checkRoleConflicts(tx *gorm.DB, userIDs []uint, ids []uint, without uint) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	conflicts, err := findRoleConflicts(tx, StaticConflict, ids)
+	if err != nil || len(conflicts) == 0 {
+		return err
+	}
+
+	// find the other roles of the users
+	var existing []UserRole
+	query := tx.Where("user_id IN (?)", userIDs)
+	if without != 0 {
+		query = query.Where("role_id <> ?", without)
+	}
+	if err := query.Find(&existing).Error; err != nil {
+		return err
+	}
+
+	held := make(map[uint]map[uint]bool, len(userIDs))
+	for _, userID := range userIDs {
+		held[userID] = map[uint]bool{}
+		for _, id := range ids {
+			held[userID][id] = true
+		}
+	}
+	for _, ur := range existing {
+		held[ur.UserID][ur.RoleID] = true
+	}
+
+	for _, userID := range userIDs {
+		for _, c := range conflicts {
+			if held[userID][c.roleID] && held[userID][c.conflictingRoleID] {
+				return fmt.Errorf("%w: user %d cannot hold both %s and %s", ErrRoleConflict, userID, c.role, c.conflictingRole)
+			}
+		}
+	}
+
+	return nil
+}
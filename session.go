@@ -0,0 +1,134 @@
+package AuthorizationGo
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Session is the subset of the roles of a user activated for a task, two roles
+// in dynamic conflict cannot be active at the same time. Its permission checks
+// only consider the active roles still assigned to the user. It is safe for
+// concurrent use.
+type Session struct {
+	auth   *AuthorizationX
+	userID uint
+
+	mu     sync.Mutex
+	active map[uint]string
+}
+
+// NewSession starts a session of the user with the roles active
+func (a *AuthorizationX) NewSession(userID uint, roleNames ...string) (*Session, error) {
+	s := &Session{auth: a, userID: userID, active: map[uint]string{}}
+	if err := s.ActivateRoles(roleNames...); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// UserID returns the user of the session
+func (s *Session) UserID() uint {
+	return s.userID
+}
+
+// ActiveRoles returns the names of the active roles, sorted
+func (s *Session) ActiveRoles() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.active))
+	for _, name := range s.active {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// ActivateRoles activates roles assigned to the user, it fails with
+// ErrRoleNotAssigned or ErrRoleConflict without activating any of them
+func (s *Session) ActivateRoles(roleNames ...string) (err error) {
+	op := s.auth.startSpan("Session.ActivateRoles", userAttr(s.userID), rolesAttr(roleNames))
+	defer op.end(&err)
+
+	if len(roleNames) == 0 {
+		return nil
+	}
+	db := s.auth.DB.WithContext(op.ctx)
+
+	roles, err := findRoles(db, roleNames)
+	if err != nil {
+		return err
+	}
+
+	// make sure the user holds the roles
+	var count int64
+	res := db.Model(&UserRole{}).Where("user_id = ?", s.userID).Where("role_id IN (?)", roleIDs(roles)).Count(&count)
+	if res.Error != nil {
+		return res.Error
+	}
+	if int(count) != len(roles) {
+		return ErrRoleNotAssigned
+	}
+
+	conflicts, err := findRoleConflicts(db, DynamicConflict, roleIDs(roles))
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	active := make(map[uint]bool, len(s.active)+len(roles))
+	for id := range s.active {
+		active[id] = true
+	}
+	for _, role := range roles {
+		active[role.ID] = true
+	}
+	for _, c := range conflicts {
+		if active[c.roleID] && active[c.conflictingRoleID] {
+			return fmt.Errorf("%w: %s and %s cannot be active in the same session", ErrRoleConflict, c.role, c.conflictingRole)
+		}
+	}
+
+	for _, role := range roles {
+		s.active[role.ID] = role.Name
+	}
+	return nil
+}
+
+// DeactivateRole deactivates a role, nothing happens when it is not active
+func (s *Session) DeactivateRole(roleName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, name := range s.active {
+		if name == roleName {
+			delete(s.active, id)
+		}
+	}
+}
+
+// CheckPermission tells if one of the active roles, still assigned to the
+// user, grants the permission
+func (s *Session) CheckPermission(permName string) (allowed bool, err error) {
+	op := s.auth.startSpan("Session.CheckPermission", userAttr(s.userID), permissionAttr(permName))
+	defer op.endCheck(&allowed, &err)
+
+	s.mu.Lock()
+	ids := make([]uint, 0, len(s.active))
+	for id := range s.active {
+		ids = append(ids, id)
+	}
+	s.mu.Unlock()
+
+	start := time.Now()
+	v, err := s.auth.checkPermission(s.userID, permName, ids)
+	s.auth.observe(Decision{Check: SessionCheck, UserID: s.userID, Permission: permName, Allowed: v.allowed, MatchedRole: v.role, Err: err, Duration: time.Since(start)})
+
+	return v.allowed, err
+}
@@ -0,0 +1,186 @@
+package AuthorizationGo
+
+import (
+	"errors"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// Query is a permission check of a simulation
+type Query struct {
+	UserID     uint   `json:"user_id"`
+	Permission string `json:"permission"`
+}
+
+// QueryResult is the outcome of a query before and after the changes, with
+// the role granting the permission when it is allowed
+type QueryResult struct {
+	Query
+	Before     bool   `json:"before"`
+	After      bool   `json:"after"`
+	BeforeRole string `json:"before_role,omitempty"`
+	AfterRole  string `json:"after_role,omitempty"`
+}
+
+// Flipped reports whether the changes turn the decision around
+func (r QueryResult) Flipped() bool {
+	return r.Before != r.After
+}
+
+// Simulation is the outcome of Simulate, with a result per query
+type Simulation struct {
+	Results []QueryResult `json:"results"`
+}
+
+// Flipped returns the results whose decision the changes turn around
+func (s *Simulation) Flipped() []QueryResult {
+	flipped := []QueryResult{}
+	for _, r := range s.Results {
+		if r.Flipped() {
+			flipped = append(flipped, r)
+		}
+	}
+
+	return flipped
+}
+
+// errSimulated rolls back the transaction of a simulation
+var errSimulated = errors.New("simulated")
+
+// Simulate evaluates the queries as if the changes were applied, the changes
+// are applied in a transaction which is rolled back so nothing is written and
+// no event is published. Without queries every user and permission pair
+// allowed before or after the changes is evaluated, so the flipped results are
+// the users gaining or losing a permission. A permission missing on either
+// side is denied.
+func (a *AuthorizationX) Simulate(changes []Change, queries []Query) (sim *Simulation, err error) {
+	op := a.startSpan("Simulate")
+	defer op.end(&err)
+
+	sim = &Simulation{}
+	err = a.DB.Transaction(func(tx *gorm.DB) error {
+		// the simulated checks bypass the cache and the decision hooks
+		txAuth := a.withTx(op.ctx, tx)
+		txAuth.cache = nil
+
+		var before *Policy
+		if len(queries) == 0 {
+			var err error
+			if before, err = txAuth.ExportPolicy(); err != nil {
+				return err
+			}
+		} else {
+			sim.Results = make([]QueryResult, len(queries))
+			for i, q := range queries {
+				v, err := txAuth.simulatedCheck(q)
+				if err != nil {
+					return err
+				}
+				sim.Results[i] = QueryResult{Query: q, Before: v.allowed, BeforeRole: v.role}
+			}
+		}
+
+		if err := applyChanges(txAuth, changes); err != nil {
+			return err
+		}
+
+		if len(queries) == 0 {
+			after, err := txAuth.ExportPolicy()
+			if err != nil {
+				return err
+			}
+			sim.Results = allowedQueries(before, after)
+			for i := range sim.Results {
+				r := &sim.Results[i]
+				r.BeforeRole = grantingRole(before, r.Query)
+				r.Before = r.BeforeRole != ""
+			}
+		}
+
+		for i := range sim.Results {
+			r := &sim.Results[i]
+			v, err := txAuth.simulatedCheck(r.Query)
+			if err != nil {
+				return err
+			}
+			r.After, r.AfterRole = v.allowed, v.role
+		}
+
+		return errSimulated
+	})
+	if !errors.Is(err, errSimulated) {
+		return nil, err
+	}
+
+	return sim, nil
+}
+
+// simulatedCheck is checkPermission denying the missing permissions
+func (a *AuthorizationX) simulatedCheck(q Query) (verdict, error) {
+	v, err := a.checkPermission(q.UserID, q.Permission, nil)
+	if errors.Is(err, ErrPermissionNotFound) {
+		return verdict{}, nil
+	}
+
+	return v, err
+}
+
+// allowedQueries returns the user and permission pairs allowed by one of the
+// policies, sorted by user id and permission
+func allowedQueries(policies ...*Policy) []QueryResult {
+	set := map[Query]bool{}
+	for _, policy := range policies {
+		grants := map[string][]string{}
+		for _, role := range policy.Roles {
+			grants[role.Name] = role.Permissions
+		}
+		for _, user := range policy.Users {
+			for _, role := range user.Roles {
+				for _, perm := range grants[role] {
+					set[Query{UserID: user.ID, Permission: perm}] = true
+				}
+			}
+		}
+	}
+
+	results := make([]QueryResult, 0, len(set))
+	for q := range set {
+		results = append(results, QueryResult{Query: q})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].UserID != results[j].UserID {
+			return results[i].UserID < results[j].UserID
+		}
+		return results[i].Permission < results[j].Permission
+	})
+
+	return results
+}
+
+// grantingRole returns the first role by name of policy granting the query,
+// or an empty string
+func grantingRole(policy *Policy, q Query) string {
+	granted := map[string]bool{}
+	for _, role := range policy.Roles {
+		for _, perm := range role.Permissions {
+			if perm == q.Permission {
+				granted[role.Name] = true
+			}
+		}
+	}
+
+	matched := ""
+	for _, user := range policy.Users {
+		if user.ID != q.UserID {
+			continue
+		}
+		for _, role := range user.Roles {
+			if granted[role] && (matched == "" || role < matched) {
+				matched = role
+			}
+		}
+	}
+
+	return matched
+}
@@ -0,0 +1,236 @@
+package AuthorizationGo
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Snapshot is a copy of every row of the tables, including the soft deleted
+// roles and permissions, so the tables can be compared over time
+type Snapshot struct {
+	TakenAt         time.Time        `json:"taken_at"`
+	Roles           []Role           `json:"roles"`
+	Permissions     []Permission     `json:"permissions"`
+	RolePermissions []RolePermission `json:"role_permissions"`
+	UserRoles       []UserRole       `json:"user_roles"`
+}
+
+// Snapshot reads all the rows of the tables in a single read only transaction,
+// sorted by id. The transaction is repeatable read so the tables are read at
+// the same point in time, the writes committed between the reads are left out.
+func (a *AuthorizationX) Snapshot() (snapshot *Snapshot, err error) {
+	op := a.startSpan("Snapshot")
+	defer op.end(&err)
+
+	snapshot = &Snapshot{
+		TakenAt:         time.Now().UTC(),
+		Roles:           []Role{},
+		Permissions:     []Permission{},
+		RolePermissions: []RolePermission{},
+		UserRoles:       []UserRole{},
+	}
+	err = a.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Order("id").Find(&snapshot.Roles).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Order("id").Find(&snapshot.Permissions).Error; err != nil {
+			return err
+		}
+		if err := tx.Order("id").Find(&snapshot.RolePermissions).Error; err != nil {
+			return err
+		}
+		return tx.Order("id").Find(&snapshot.UserRoles).Error
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// Policy returns the active roles, permissions and assignments of the snapshot,
+// as ExportPolicy would have at the time it was taken
+func (s *Snapshot) Policy() *Policy {
+	policy := &Policy{Permissions: []string{}, Roles: []RolePolicy{}, Users: []UserPolicy{}}
+
+	permNames := map[uint]string{}
+	for _, perm := range s.Permissions {
+		if !perm.DeletedAt.Valid {
+			permNames[perm.ID] = perm.Name
+			policy.Permissions = append(policy.Permissions, perm.Name)
+		}
+	}
+
+	roleNames := map[uint]string{}
+	grants := map[string][]string{}
+	for _, role := range s.Roles {
+		if !role.DeletedAt.Valid {
+			roleNames[role.ID] = role.Name
+		}
+	}
+	for _, rp := range s.RolePermissions {
+		role, roleActive := roleNames[rp.RoleID]
+		perm, permActive := permNames[rp.PermissionID]
+		if roleActive && permActive {
+			grants[role] = append(grants[role], perm)
+		}
+	}
+	for _, role := range s.Roles {
+		if !role.DeletedAt.Valid {
+			perms := grants[role.Name]
+			if perms == nil {
+				perms = []string{}
+			}
+			policy.Roles = append(policy.Roles, RolePolicy{Name: role.Name, Permissions: perms})
+		}
+	}
+
+	users := map[uint]int{}
+	for _, ur := range s.UserRoles {
+		role, ok := roleNames[ur.RoleID]
+		if !ok {
+			continue
+		}
+		i, ok := users[ur.UserID]
+		if !ok {
+			i = len(policy.Users)
+			users[ur.UserID] = i
+			policy.Users = append(policy.Users, UserPolicy{ID: ur.UserID})
+		}
+		policy.Users[i].Roles = append(policy.Users[i].Roles, role)
+	}
+
+	return policy
+}
+
+// Grant is a permission granted to a role
+type Grant struct {
+	Role       string `json:"role"`
+	Permission string `json:"permission"`
+}
+
+// Assignment is a role assigned to a user
+type Assignment struct {
+	UserID uint   `json:"user_id"`
+	Role   string `json:"role"`
+}
+
+// SnapshotDiff lists the active roles, permissions, grants and assignments
+// added and removed between two snapshots, sorted by name and user id
+type SnapshotDiff struct {
+	From               time.Time    `json:"from"`
+	To                 time.Time    `json:"to"`
+	AddedRoles         []string     `json:"added_roles"`
+	RemovedRoles       []string     `json:"removed_roles"`
+	AddedPermissions   []string     `json:"added_permissions"`
+	RemovedPermissions []string     `json:"removed_permissions"`
+	AddedGrants        []Grant      `json:"added_grants"`
+	RemovedGrants      []Grant      `json:"removed_grants"`
+	AddedAssignments   []Assignment `json:"added_assignments"`
+	RemovedAssignments []Assignment `json:"removed_assignments"`
+}
+
+// Diff compares the active entries of two snapshots by name, a renamed role or
+// permission is reported as removed and added along with its grants and
+// assignments
+func Diff(from, to *Snapshot) *SnapshotDiff {
+	d := &SnapshotDiff{
+		From:               from.TakenAt,
+		To:                 to.TakenAt,
+		AddedRoles:         []string{},
+		RemovedRoles:       []string{},
+		AddedPermissions:   []string{},
+		RemovedPermissions: []string{},
+		AddedGrants:        []Grant{},
+		RemovedGrants:      []Grant{},
+		AddedAssignments:   []Assignment{},
+		RemovedAssignments: []Assignment{},
+	}
+
+	for _, c := range diffPolicies(from.Policy(), to.Policy(), true).Changes {
+		switch c.Kind {
+		case CreateRoleChange:
+			d.AddedRoles = append(d.AddedRoles, c.Role)
+		case DeleteRoleChange:
+			d.RemovedRoles = append(d.RemovedRoles, c.Role)
+		case CreatePermissionChange:
+			d.AddedPermissions = append(d.AddedPermissions, c.Permission)
+		case DeletePermissionChange:
+			d.RemovedPermissions = append(d.RemovedPermissions, c.Permission)
+		case GrantChange:
+			d.AddedGrants = append(d.AddedGrants, Grant{Role: c.Role, Permission: c.Permission})
+		case UngrantChange:
+			d.RemovedGrants = append(d.RemovedGrants, Grant{Role: c.Role, Permission: c.Permission})
+		case AssignChange:
+			d.AddedAssignments = append(d.AddedAssignments, Assignment{UserID: c.UserID, Role: c.Role})
+		case RevokeChange:
+			d.RemovedAssignments = append(d.RemovedAssignments, Assignment{UserID: c.UserID, Role: c.Role})
+		}
+	}
+
+	return d
+}
+
+// Empty reports whether the snapshots have the same active entries
+func (d *SnapshotDiff) Empty() bool {
+	return len(d.AddedRoles)+len(d.RemovedRoles)+
+		len(d.AddedPermissions)+len(d.RemovedPermissions)+
+		len(d.AddedGrants)+len(d.RemovedGrants)+
+		len(d.AddedAssignments)+len(d.RemovedAssignments) == 0
+}
+
+// String returns the diff as a report with a section per kind of entry, + for
+// additions and - for removals
+func (d *SnapshotDiff) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Changes from %s to %s\n", d.From.Format(time.RFC3339), d.To.Format(time.RFC3339))
+	if d.Empty() {
+		b.WriteString("No changes.\n")
+		return b.String()
+	}
+
+	section := func(title string, added, removed []string) {
+		if len(added)+len(removed) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "\n%s:\n", title)
+		for _, line := range added {
+			fmt.Fprintf(&b, "  + %s\n", line)
+		}
+		for _, line := range removed {
+			fmt.Fprintf(&b, "  - %s\n", line)
+		}
+	}
+	section("Roles", d.AddedRoles, d.RemovedRoles)
+	section("Permissions", d.AddedPermissions, d.RemovedPermissions)
+	section("Grants", grantLines(d.AddedGrants), grantLines(d.RemovedGrants))
+	section("Assignments", assignmentLines(d.AddedAssignments), assignmentLines(d.RemovedAssignments))
+
+	added := len(d.AddedRoles) + len(d.AddedPermissions) + len(d.AddedGrants) + len(d.AddedAssignments)
+	removed := len(d.RemovedRoles) + len(d.RemovedPermissions) + len(d.RemovedGrants) + len(d.RemovedAssignments)
+	fmt.Fprintf(&b, "\n%d added, %d removed.\n", added, removed)
+
+	return b.String()
+}
+
+func grantLines(grants []Grant) []string {
+	lines := make([]string, len(grants))
+	for i, g := range grants {
+		lines[i] = g.Role + " " + g.Permission
+	}
+
+	return lines
+}
+
+func assignmentLines(assignments []Assignment) []string {
+	lines := make([]string, len(assignments))
+	for i, as := range assignments {
+		lines[i] = fmt.Sprintf("%d %s", as.UserID, as.Role)
+	}
+
+	return lines
+}
@@ -0,0 +1,116 @@
+package AuthorizationGo
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// tracerName is the instrumentation name of the spans
+const tracerName = "github.com/SoegiDev/AuthorizationGo"
+
+// WithContext returns a copy of a whose spans are children of the span of
+// ctx and whose queries use ctx
+func (a *AuthorizationX) WithContext(ctx context.Context) *AuthorizationX {
+	c := a.clone(a.DB.WithContext(ctx))
+	c.ctx = ctx
+
+	return c
+}
+
+// clone returns a copy of a using db, sharing the hooks, the cache and the
+// tracer
+func (a *AuthorizationX) clone(db *gorm.DB) *AuthorizationX {
+	return &AuthorizationX{
+		DB:      db,
+		events:  a.bus(),
+		outbox:  a.outbox,
+		cache:   a.cache,
+		tracer:  a.tracer,
+		ctx:     a.ctx,
+		pending: a.pending,
+	}
+}
+
+func (a *AuthorizationX) context() context.Context {
+	if a.ctx == nil {
+		return context.Background()
+	}
+	return a.ctx
+}
+
+func newTracer(provider trace.TracerProvider) trace.Tracer {
+	if provider == nil {
+		provider = trace.NewNoopTracerProvider()
+	}
+	return provider.Tracer(tracerName)
+}
+
+// operation is the span of a method
+type operation struct {
+	ctx  context.Context
+	span trace.Span
+}
+
+// startSpan starts the span of a method as a child of the span of a.ctx
+func (a *AuthorizationX) startSpan(method string, attrs ...attribute.KeyValue) *operation {
+	tracer := a.tracer
+	if tracer == nil {
+		tracer = newTracer(nil)
+	}
+
+	ctx, span := tracer.Start(a.context(), "AuthorizationX."+method, trace.WithAttributes(attrs...))
+	return &operation{ctx: ctx, span: span}
+}
+
+// end records the error and ends the span
+func (o *operation) end(err *error) {
+	if *err != nil {
+		o.span.RecordError(*err)
+		o.span.SetStatus(codes.Error, (*err).Error())
+	}
+	o.span.End()
+}
+
+// endCheck records the decision and ends the span
+func (o *operation) endCheck(allowed *bool, err *error) {
+	if *err == nil {
+		o.span.SetAttributes(attribute.Bool("authorization.allowed", *allowed))
+	}
+	o.end(err)
+}
+
+func userAttr(userID uint) attribute.KeyValue {
+	return attribute.Int64("authorization.user_id", int64(userID))
+}
+
+func roleAttr(roleName string) attribute.KeyValue {
+	return attribute.String("authorization.role", roleName)
+}
+
+func conflictingRoleAttr(roleName string) attribute.KeyValue {
+	return attribute.String("authorization.conflicting_role", roleName)
+}
+
+func prerequisiteRoleAttr(roleName string) attribute.KeyValue {
+	return attribute.String("authorization.prerequisite_role", roleName)
+}
+
+func permissionAttr(permName string) attribute.KeyValue {
+	return attribute.String("authorization.permission", permName)
+}
+
+func newNameAttr(newName string) attribute.KeyValue {
+	return attribute.String("authorization.new_name", newName)
+}
+
+func rolesAttr(roleNames []string) attribute.KeyValue {
+	return attribute.StringSlice("authorization.roles", roleNames)
+}
+
+func permissionsAttr(permNames []string) attribute.KeyValue {
+	return attribute.StringSlice("authorization.permissions", permNames)
+}
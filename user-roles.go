@@ -2,8 +2,8 @@ package AuthorizationGo
 
 type UserRole struct {
 	ID     uint
-	UserID uint
-	RoleID uint
+	UserID uint `gorm:"index"`
+	RoleID uint `gorm:"index"`
 }
 
 func (u UserRole) TableName() string {